@@ -0,0 +1,15 @@
+-- MySQL archive of the raw adapter payloads. Every distinct version of a
+-- payload is kept, so history can be reprocessed without fetching it again.
+create table if not exists raw_payloads
+(
+    adapter         VARCHAR(255) NOT NULL,
+    repository_id   VARCHAR(255) NOT NULL,
+    entity          VARCHAR(64)  NOT NULL,
+    id              VARCHAR(255) NOT NULL,
+    payload_hash    CHAR(64)     NOT NULL,
+    payload         JSON         NOT NULL,
+    fetched_at      DATETIME(6)  NOT NULL,
+    last_fetched_at DATETIME(6)  NOT NULL,
+    primary key (adapter, repository_id, entity, id, payload_hash),
+    index raw_payloads_fetched_at (adapter, repository_id, entity, fetched_at)
+);
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/rodaine/table"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/corrections"
+	"thesis/scraper/internal/export"
+	"thesis/scraper/internal/metricsdatabase"
+	"thesis/scraper/internal/sqldatabase"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+const usage = `Usage:
+  scraper [--dry-run] [--dry-run-output file]    Scrape and aggregate all configured repositories
+  scraper runs list                              List the latest scrape runs
+  scraper show <entity> <id>                     Print a stored repository, issue, pull request or deployment
+  scraper correct <entity> <id> field=value...   Manually correct a stored item and aggregate its repository again
+  scraper corrections list                       List the manual corrections of a repository
+  scraper history <entity> <id>                  List the changes of a stored item
+  scraper export -table <table> [-format csv]     Write a base data or metrics table to a CSV, JSONL or Parquet file
+  scraper import [-table <table>] <file>         Upsert base data from a CSV or JSONL file with the columns of an export,
+                                                 or with -format items from JSONL of the items of one repository
+  scraper prune                                  Delete the rows that are older than the retention of their table
+  scraper migrate up                             Apply all pending schema migrations
+  scraper migrate status                         List the schema migrations and whether they were applied
+`
+
+func runCommand(args []string) {
+	switch args[0] {
+	case "runs":
+		if len(args) > 1 && args[1] == "list" {
+			listRuns(args[2:])
+			return
+		}
+	case "show":
+		show(args[1:])
+		return
+	case "correct":
+		correct(args[1:])
+		return
+	case "corrections":
+		if len(args) > 1 && args[1] == "list" {
+			listCorrections(args[2:])
+			return
+		}
+	case "history":
+		listChanges(args[1:])
+		return
+	case "export":
+		exportTable(args[1:])
+		return
+	case "import":
+		importTable(args[1:])
+		return
+	case "prune":
+		prune(args[1:])
+		return
+	case "migrate":
+		if len(args) > 1 && (args[1] == "up" || args[1] == "status") {
+			migrate(args[1])
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", strings.Join(args, " "), usage)
+	os.Exit(2)
+}
+
+func listRuns(args []string) {
+	flags := flag.NewFlagSet("runs list", flag.ExitOnError)
+	adapter := flags.String("adapter", "", "only list runs of this adapter")
+	repository := flags.String("repository", "", "only list runs of this repository")
+	limit := flags.Int("limit", 20, "maximum number of runs to list")
+	_ = flags.Parse(args)
+
+	openStore()
+	defer store.Close()
+
+	runs, err := store.ListScrapeRuns(context.Background(), *adapter, *repository, *limit)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	tbl := table.New("Run", "Adapter", "Repository", "Stage", "Started", "Duration", "Status", "Counts", "Instance", "Version")
+	for _, run := range runs {
+		duration := ""
+		if run.FinishedAt != nil {
+			duration = run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond).String()
+		}
+
+		tbl.AddRow(run.RunId, run.Adapter, run.RepositoryId, run.Stage, run.StartedAt.Local().Format(time.DateTime), duration, formatRunStatus(run), formatCounts(run.Counts), run.Instance, run.ScraperVersion)
+	}
+
+	tbl.Print()
+}
+
+func formatRunStatus(run internal.ScrapeRun) string {
+	if len(run.Errors) > 0 {
+		return run.Status + ": " + strings.Join(run.Errors, "; ")
+	}
+
+	return run.Status
+}
+
+func formatCounts(counts map[string]int) string {
+	var keys []string
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", key, counts[key]))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func show(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	adapterName := flags.String("adapter", "", "adapter of the item")
+	repository := flags.String("repository", "", "repository of the item, not needed for repositories")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		internal.ProcessError(fmt.Errorf("usage: scraper show -adapter <adapter> [-repository <id>] <%s> <id>", strings.Join(corrections.Entities(), "|")))
+	}
+
+	adapter := adapterByName(*adapterName)
+
+	openStore()
+	defer store.Close()
+
+	item, err := corrections.Find(context.Background(), adapter, *repository, flags.Arg(0), flags.Arg(1), store)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(item); err != nil {
+		internal.ProcessError(err)
+	}
+}
+
+func correct(args []string) {
+	flags := flag.NewFlagSet("correct", flag.ExitOnError)
+	adapterName := flags.String("adapter", "", "adapter of the item")
+	repository := flags.String("repository", "", "repository of the item, not needed for repositories")
+	author := flags.String("author", os.Getenv("USER"), "who made the correction")
+	_ = flags.Parse(args)
+
+	if flags.NArg() < 3 {
+		internal.ProcessError(fmt.Errorf("usage: scraper correct -adapter <adapter> [-repository <id>] <%s> <id> field=value...", strings.Join(corrections.Entities(), "|")))
+	}
+
+	adapter := adapterByName(*adapterName)
+	correction := internal.Correction{
+		Adapter:      adapter.Name,
+		RepositoryId: *repository,
+		Entity:       flags.Arg(0),
+		Id:           flags.Arg(1),
+		Fields:       make(map[string]string),
+		Author:       *author,
+	}
+	for _, assignment := range flags.Args()[2:] {
+		field, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			internal.ProcessError(fmt.Errorf("%q is not a field=value pair", assignment))
+		}
+		correction.Fields[field] = value
+	}
+
+	openStore()
+	defer store.Close()
+
+	if err := corrections.Apply(context.Background(), correction, store); err != nil {
+		internal.ProcessError(err)
+	}
+
+	repositoryId := correction.RepositoryId
+	if correction.Entity == storage.EntityRepositories {
+		repositoryId = correction.Id
+	}
+	reaggregate(adapter, repositoryId)
+	fmt.Println("Correction applied")
+}
+
+func listCorrections(args []string) {
+	flags := flag.NewFlagSet("corrections list", flag.ExitOnError)
+	adapterName := flags.String("adapter", "", "adapter of the repository")
+	repository := flags.String("repository", "", "repository to list the corrections of")
+	_ = flags.Parse(args)
+
+	adapter := adapterByName(*adapterName)
+
+	openStore()
+	defer store.Close()
+
+	corrections, err := store.ListCorrections(context.Background(), adapter.Name, *repository)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	tbl := table.New("Corrected", "Author", "Entity", "Id", "Fields")
+	for _, correction := range corrections {
+		tbl.AddRow(correction.CorrectedAt.Local().Format(time.DateTime), correction.Author, correction.Entity, correction.Id, formatFields(correction.Fields))
+	}
+
+	tbl.Print()
+}
+
+func listChanges(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	adapterName := flags.String("adapter", "", "adapter of the item")
+	repository := flags.String("repository", "", "repository of the item, not needed for repositories")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		internal.ProcessError(fmt.Errorf("usage: scraper history -adapter <adapter> [-repository <id>] <entity> <id>"))
+	}
+
+	adapter := adapterByName(*adapterName)
+	entity, id := flags.Arg(0), flags.Arg(1)
+	if entity == storage.EntityRepositories {
+		*repository = id
+	}
+
+	openStore()
+	defer store.Close()
+
+	changes, err := store.ListChanges(context.Background(), adapter.Name, *repository, entity, id)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	tbl := table.New("Changed", "Source", "Field", "Old", "New")
+	for _, change := range changes {
+		tbl.AddRow(change.ChangedAt.Local().Format(time.DateTime), change.Source, change.Field, change.OldValue, change.NewValue)
+	}
+
+	tbl.Print()
+}
+
+func formatFields(fields map[string]string) string {
+	var keys []string
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", key, fields[key]))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func adapterByName(name string) internal.Adapter {
+	for _, adapter := range config.Adapters {
+		if strings.EqualFold(adapter.Name, name) {
+			return adapter
+		}
+	}
+
+	internal.ProcessError(fmt.Errorf("unknown adapter %q", name))
+	return internal.Adapter{}
+}
+
+func exportTable(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	name := flags.String("table", "", "table to export, one of "+strings.Join(export.Tables(), ", "))
+	format := flags.String("format", export.FormatCsv, "file format, csv, jsonl or parquet")
+	output := flags.String("output", "", "file to write, defaults to <table>.<format>, - writes to stdout")
+	adapterName := flags.String("adapter", "", "only export rows of this adapter")
+	repository := flags.String("repository", "", "only export rows of this repository")
+	groupingKey := flags.String("grouping-key", "", "only export rows of repositories with this grouping key")
+	from := flags.String("from", "", "only export rows created on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only export rows created before this date (YYYY-MM-DD)")
+	_ = flags.Parse(args)
+
+	if *name == "" {
+		internal.ProcessError(fmt.Errorf("usage: scraper export -table <%s> [-format csv|jsonl|parquet] [-output file]", strings.Join(export.Tables(), "|")))
+	}
+
+	filter := export.Filter{
+		Repository:  *repository,
+		GroupingKey: *groupingKey,
+		From:        parseDate(*from),
+		To:          parseDate(*to),
+	}
+
+	adapters := config.Adapters
+	if *adapterName != "" {
+		adapters = []internal.Adapter{adapterByName(*adapterName)}
+	}
+
+	openStore()
+	defer store.Close()
+
+	out := os.Stdout
+	if *output == "" {
+		*output = *name + "." + *format
+	}
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			internal.ProcessError(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	count, err := export.Export(context.Background(), *name, *format, adapters, filter, out, store)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	if *output != "-" {
+		fmt.Printf("Exported %d rows to %s\n", count, *output)
+	}
+}
+
+func importTable(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	name := flags.String("table", "", "table to import, defaults to the name of the file without its extension")
+	format := flags.String("format", "", "file format, csv, jsonl or items, defaults to the extension of the file")
+	adapterName := flags.String("adapter", "", "adapter of the items, only for the items format")
+	repositoryId := flags.String("repository", "", "repository of the items, only for the items format")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		internal.ProcessError(fmt.Errorf("usage: scraper import [-table <%s>] [-format csv|jsonl|items] [-adapter <adapter>] [-repository <id>] <file>", strings.Join(export.ImportTables(), "|")))
+	}
+
+	path := flags.Arg(0)
+	extension := filepath.Ext(path)
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(path), extension)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(extension, ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+	defer file.Close()
+
+	openStore()
+	defer store.Close()
+
+	var imported []export.Imported
+	if *format == export.FormatItems {
+		imported, err = export.ImportItems(context.Background(), *name, adapterByName(*adapterName), *repositoryId, file, store)
+	} else {
+		imported, err = export.Import(context.Background(), *name, *format, config.Adapters, file, store)
+	}
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	// The metrics are calculated from the base data, so they are outdated now
+	tbl := table.New("Adapter", "Repository", "Rows", "Failed")
+	for _, repository := range imported {
+		reaggregate(repository.Adapter, repository.Repository.Id)
+		tbl.AddRow(repository.Adapter.Name, repository.Repository.Id, repository.Rows, repository.Failed)
+	}
+
+	tbl.Print()
+}
+
+func parseDate(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		internal.ProcessError(fmt.Errorf("%q is not a date: %w", value, err))
+	}
+
+	return date
+}
+
+func prune(args []string) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	only := flags.String("table", "", "only prune this table")
+	_ = flags.Parse(args)
+
+	openStore()
+	defer store.Close()
+
+	var tables []string
+	for table, retention := range config.Storage.Retention {
+		if retention > 0 && (*only == "" || *only == table) {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+
+	if *only != "" && len(tables) == 0 {
+		internal.ProcessError(fmt.Errorf("no retention is configured for %q", *only))
+	}
+
+	tbl := table.New("Table", "Retention", "Deleted")
+	for _, name := range tables {
+		retention := config.Storage.Retention[name]
+		deleted, err := store.Prune(context.Background(), name, time.Now().Add(-retention))
+		if err != nil {
+			internal.ProcessError(err)
+		}
+		tbl.AddRow(name, retention, deleted)
+	}
+
+	tbl.Print()
+}
+
+func migrate(command string) {
+	var migrations []storage.Migration
+
+	switch strings.ToLower(config.Storage.Backend) {
+	case "", "cassandra":
+		connectToDatabase()
+		defer metricsdatabase.Close(metricsDatabase)
+
+		if command == "up" {
+			versions := metricsdatabase.MigrateUp(metricsDatabase)
+			fmt.Printf("Applied %d migrations\n", len(versions))
+			return
+		}
+		migrations = metricsdatabase.MigrationStatus(metricsDatabase)
+	case "postgres", "sqlite":
+		// Opening the store applies the pending migrations
+		openStore()
+		defer store.Close()
+
+		if command == "up" {
+			fmt.Println("Schema is up to date")
+			return
+		}
+		migrations = sqldatabase.MigrationStatus(context.Background(), store.(*sqldatabase.Store))
+	default:
+		internal.ProcessError(fmt.Errorf("the %q storage backend has no schema to migrate", config.Storage.Backend))
+	}
+
+	tbl := table.New("Version", "Applied")
+	for _, migration := range migrations {
+		applied := "pending"
+		if migration.AppliedAt != nil {
+			applied = migration.AppliedAt.Local().Format(time.DateTime)
+		}
+		if !migration.Known {
+			applied += " (unknown to this scraper)"
+		}
+
+		tbl.AddRow(migration.Version, applied)
+	}
+
+	tbl.Print()
+}
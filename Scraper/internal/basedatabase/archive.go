@@ -0,0 +1,86 @@
+package basedatabase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Payload is the raw JSON of a single entity, as it was returned by an adapter.
+type Payload struct {
+	Adapter      string
+	RepositoryId string
+	Entity       string
+	Id           string
+	FetchedAt    time.Time
+	Hash         string
+	Json         json.RawMessage
+}
+
+// Stays well below the placeholder limit of MySQL
+var chunkSize = 500
+
+// ArchivePayloads stores every distinct version of a payload once. Fetching an
+// unchanged payload again only updates last_fetched_at.
+func ArchivePayloads(ctx context.Context, client *DatabaseClient, payloads []Payload) error {
+	for i := 0; i < len(payloads); i += chunkSize {
+		end := i + chunkSize
+		if end > len(payloads) {
+			end = len(payloads)
+		}
+
+		var placeholders []string
+		var values []any
+
+		for _, payload := range payloads[i:end] {
+			if payload.Hash == "" {
+				payload.Hash = Hash(payload.Json)
+			}
+
+			placeholders = append(placeholders, "(?,?,?,?,?,?,?,?)")
+			values = append(values, payload.Adapter, payload.RepositoryId, payload.Entity, payload.Id, payload.Hash, string(payload.Json), payload.FetchedAt.UTC(), payload.FetchedAt.UTC())
+		}
+
+		_, err := client.db.ExecContext(ctx, "INSERT INTO raw_payloads (`adapter`, `repository_id`, `entity`, `id`, `payload_hash`, `payload`, `fetched_at`, `last_fetched_at`) VALUES "+
+			strings.Join(placeholders, ",")+" ON DUPLICATE KEY UPDATE `last_fetched_at` = VALUES(`last_fetched_at`)", values...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListPayloads returns all archived versions of the payloads of an entity,
+// ordered by id and the time they were first fetched.
+func ListPayloads(ctx context.Context, client *DatabaseClient, adapter string, repositoryId string, entity string) (payloads []Payload, err error) {
+	rows, err := client.db.QueryContext(ctx, "SELECT `id`, `payload_hash`, `payload`, `fetched_at` FROM raw_payloads WHERE `adapter` = ? AND `repository_id` = ? AND `entity` = ? ORDER BY `id`, `fetched_at`",
+		adapter, repositoryId, entity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		payload := Payload{Adapter: adapter, RepositoryId: repositoryId, Entity: entity}
+
+		var encoded []byte
+		err = rows.Scan(&payload.Id, &payload.Hash, &encoded, &payload.FetchedAt)
+		if err != nil {
+			return nil, err
+		}
+		payload.Json = encoded
+
+		payloads = append(payloads, payload)
+	}
+
+	return payloads, rows.Err()
+}
+
+func Hash(payload json.RawMessage) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,7 @@
 package basedatabase
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"thesis/scraper/internal"
@@ -16,7 +17,7 @@ type DatabaseClient struct {
 
 func CreateClient(config internal.BaseDatabaseConfig) *DatabaseClient {
 	var err error
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s?tls=preferred", config.Username, config.Password, config.Host, config.Database))
+	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s?tls=preferred&parseTime=true&loc=UTC", config.Username, config.Password, config.Host, config.Database))
 	if err != nil {
 		internal.ProcessError(err)
 		return nil
@@ -29,30 +30,15 @@ func CreateClient(config internal.BaseDatabaseConfig) *DatabaseClient {
 	return &DatabaseClient{config: config, db: db}
 }
 
-func InsertJson(client *DatabaseClient, query string, values ...any) bool {
-	stmtIns, err := client.db.Prepare(query)
-	if err != nil {
-		internal.ProcessError(err)
-		return false
-	}
-	defer stmtIns.Close()
-
-	exec, err := stmtIns.Exec(values...)
-	if err != nil {
-		internal.ProcessError(err)
-		return false
-	}
-
-	rows, err := exec.RowsAffected()
-	if err != nil {
-		internal.ProcessError(err)
-		return false
-	}
-
-	return rows > 0
+func Ping(ctx context.Context, client *DatabaseClient) error {
+	return client.db.PingContext(ctx)
 }
 
 func Close(client *DatabaseClient) {
+	if client == nil {
+		return
+	}
+
 	err := client.db.Close()
 	if err != nil {
 		internal.ProcessError(err)
@@ -0,0 +1,251 @@
+package corrections
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+)
+
+// Prefix is the path the API is served under.
+const Prefix = "/api/v1/"
+
+type patch struct {
+	Fields map[string]string `json:"fields"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the stored items and accepts corrections for them:
+//
+//	GET   /api/v1/{adapter}/repositories
+//	GET   /api/v1/{adapter}/repositories/{id}
+//	PATCH /api/v1/{adapter}/repositories/{id}
+//	GET   /api/v1/{adapter}/repositories/{repository}/{entity}
+//	GET   /api/v1/{adapter}/repositories/{repository}/{entity}/{id}
+//	PATCH /api/v1/{adapter}/repositories/{repository}/{entity}/{id}
+//	GET   /api/v1/{adapter}/repositories/{repository}/corrections
+//	GET   /api/v1/{adapter}/repositories/{id}/history
+//	GET   /api/v1/{adapter}/repositories/{repository}/{entity}/{id}/history
+//
+// Every request needs one of the bearer tokens, whose user is recorded as the
+// author of a correction. After a correction, reaggregate is called for the
+// repository in the background.
+func Handler(adapters []internal.Adapter, tokens []internal.TokenConfig, store storage.Store, reaggregate func(adapter internal.Adapter, repositoryId string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(r, tokens)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+
+		segments, err := pathSegments(r)
+		if err != nil || len(segments) < 2 || segments[1] != storage.EntityRepositories {
+			writeError(w, http.StatusNotFound, errors.New("unknown path"))
+			return
+		}
+
+		adapter, ok := findAdapter(adapters, segments[0])
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("unknown adapter"))
+			return
+		}
+
+		var repositoryId, entity, id string
+		var showHistory bool
+		switch len(segments) {
+		case 2:
+			entity = storage.EntityRepositories
+		case 3:
+			entity, id = storage.EntityRepositories, segments[2]
+		case 4:
+			repositoryId, entity = segments[2], segments[3]
+			if entity == "history" {
+				entity, id, showHistory = storage.EntityRepositories, repositoryId, true
+			}
+		case 5:
+			repositoryId, entity, id = segments[2], segments[3], segments[4]
+		case 6:
+			repositoryId, entity, id = segments[2], segments[3], segments[4]
+			showHistory = segments[5] == "history"
+			if !showHistory {
+				writeError(w, http.StatusNotFound, errors.New("unknown path"))
+				return
+			}
+		default:
+			writeError(w, http.StatusNotFound, errors.New("unknown path"))
+			return
+		}
+
+		ctx := r.Context()
+
+		switch {
+		case r.Method == http.MethodGet && showHistory:
+			changes, err := store.ListChanges(ctx, adapter.Name, repositoryId, entity, id)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJson(w, http.StatusOK, changes)
+		case showHistory:
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		case r.Method == http.MethodGet && entity == "corrections" && id == "":
+			corrections, err := store.ListCorrections(ctx, adapter.Name, repositoryId)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJson(w, http.StatusOK, corrections)
+		case r.Method == http.MethodGet && id == "":
+			items, err := list(r, adapter, repositoryId, entity, store)
+			if err != nil {
+				writeError(w, status(err, http.StatusNotFound), err)
+				return
+			}
+			writeJson(w, http.StatusOK, items)
+		case r.Method == http.MethodGet:
+			item, err := Find(ctx, adapter, repositoryId, entity, id, store)
+			if err != nil {
+				writeError(w, status(err, http.StatusNotFound), err)
+				return
+			}
+			writeJson(w, http.StatusOK, item)
+		case r.Method == http.MethodPatch && id != "":
+			var body patch
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			correction := internal.Correction{
+				Adapter:      adapter.Name,
+				RepositoryId: repositoryId,
+				Entity:       entity,
+				Id:           id,
+				Fields:       body.Fields,
+				Author:       user,
+			}
+			err := Apply(ctx, correction, store)
+			if errors.Is(err, ErrNotFound) {
+				writeError(w, http.StatusNotFound, err)
+				return
+			} else if err != nil {
+				writeError(w, status(err, http.StatusBadRequest), err)
+				return
+			}
+
+			if entity == storage.EntityRepositories {
+				repositoryId = id
+			}
+			slog.Info("Applied correction", "adapter", adapter.Name, "repository", repositoryId, "entity", entity, "id", id, "author", user)
+			go reaggregate(adapter, repositoryId)
+
+			item, err := Find(ctx, adapter, repositoryId, entity, id, store)
+			if err != nil {
+				writeError(w, status(err, http.StatusNotFound), err)
+				return
+			}
+			writeJson(w, http.StatusOK, item)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	})
+}
+
+func list(r *http.Request, adapter internal.Adapter, repositoryId string, entity string, store storage.Store) (any, error) {
+	ctx := r.Context()
+	repo := internal.Repository{Id: repositoryId}
+
+	var items any
+	var err error
+	switch entity {
+	case storage.EntityRepositories:
+		items, err = store.ListRepositories(ctx, adapter)
+	case storage.EntityIssues:
+		items, err = store.ListIssues(ctx, adapter, repo)
+	case storage.EntityPullRequests:
+		items, err = store.ListPullRequests(ctx, adapter, repo)
+	case storage.EntityDeployments:
+		items, err = store.ListDeployments(ctx, adapter, repo)
+	default:
+		return nil, errors.New("unknown entity")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStore, err)
+	}
+
+	return items, nil
+}
+
+// status is 500 for errors of the store, which the request can't fix, and
+// otherwise the status of the failed lookup.
+func status(err error, lookup int) int {
+	if errors.Is(err, ErrStore) {
+		return http.StatusInternalServerError
+	}
+
+	return lookup
+}
+
+// authenticate returns the user of the bearer token of the request.
+func authenticate(r *http.Request, tokens []internal.TokenConfig) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	for _, t := range tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return t.User, true
+		}
+	}
+
+	return "", false
+}
+
+func pathSegments(r *http.Request) ([]string, error) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), Prefix), "/")
+
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, unescaped)
+	}
+
+	return segments, nil
+}
+
+func findAdapter(adapters []internal.Adapter, name string) (internal.Adapter, bool) {
+	for _, adapter := range adapters {
+		if strings.EqualFold(adapter.Name, name) {
+			return adapter, true
+		}
+	}
+
+	return internal.Adapter{}, false
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, apiError{Error: err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Warn("Could not write response", internal.ErrorAttr(err))
+	}
+}
@@ -0,0 +1,162 @@
+package corrections
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/history"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+type fieldType int
+
+const (
+	text fieldType = iota
+	nullableText
+	timestamp
+	nullableTimestamp
+)
+
+// fields lists the fields that can be corrected for each entity. Fields that
+// identify an item or link it to others can't be changed.
+var fields = map[string]map[string]fieldType{
+	storage.EntityRepositories: {
+		"full_name":      text,
+		"default_branch": text,
+		"grouping_key":   text,
+	},
+	storage.EntityIssues: {
+		"type":       nullableText,
+		"created_at": timestamp,
+		"closed_at":  nullableTimestamp,
+	},
+	storage.EntityPullRequests: {
+		"created_at": timestamp,
+		"closed_at":  nullableTimestamp,
+		"merged_at":  nullableTimestamp,
+	},
+	storage.EntityDeployments: {
+		"sha":            text,
+		"ref":            text,
+		"task":           text,
+		"commit_id":      nullableText,
+		"environment_id": nullableText,
+		"created_at":     timestamp,
+		"updated_at":     timestamp,
+	},
+}
+
+// ErrNotFound is returned when the corrected item doesn't exist.
+var ErrNotFound = fmt.Errorf("item not found")
+
+// ErrStore wraps the errors of reading or writing the store, which aren't
+// caused by the correction.
+var ErrStore = fmt.Errorf("the store failed")
+
+// Entities returns the entities that can be corrected.
+func Entities() (entities []string) {
+	for entity := range fields {
+		entities = append(entities, entity)
+	}
+	sort.Strings(entities)
+
+	return
+}
+
+// Parse validates the fields of a correction and converts them to the type of
+// each field. Timestamps are RFC 3339, an empty value clears a nullable field.
+func Parse(correction internal.Correction) (map[string]any, error) {
+	allowed, ok := fields[correction.Entity]
+	if !ok {
+		return nil, fmt.Errorf("%q can't be corrected, use one of %s", correction.Entity, strings.Join(Entities(), ", "))
+	}
+	if len(correction.Fields) == 0 {
+		return nil, fmt.Errorf("the correction doesn't change any field")
+	}
+
+	values := make(map[string]any)
+	for field, value := range correction.Fields {
+		kind, ok := allowed[field]
+		if !ok {
+			return nil, fmt.Errorf("the field %q of %s can't be corrected", field, correction.Entity)
+		}
+
+		switch {
+		case value == "" && (kind == nullableText || kind == nullableTimestamp):
+			values[field] = nil
+		case kind == text || kind == nullableText:
+			values[field] = value
+		default:
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("the field %q is not a RFC 3339 timestamp: %w", field, err)
+			}
+			values[field] = t.UTC()
+		}
+	}
+
+	return values, nil
+}
+
+// Find looks up a stored item. For repositories, repositoryId is ignored.
+func Find(ctx context.Context, adapter internal.Adapter, repositoryId string, entity string, id string, store storage.Store) (any, error) {
+	if _, ok := fields[entity]; !ok {
+		return nil, fmt.Errorf("%q can't be corrected, use one of %s", entity, strings.Join(Entities(), ", "))
+	}
+
+	item, err := store.GetItem(ctx, adapter, repositoryId, entity, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStore, err)
+	}
+	if item == nil {
+		return nil, ErrNotFound
+	}
+
+	return item, nil
+}
+
+// Apply validates a correction and stores it, if the corrected item exists.
+func Apply(ctx context.Context, correction internal.Correction, store storage.Store) error {
+	if correction.Entity == storage.EntityRepositories {
+		correction.RepositoryId = correction.Id
+	}
+	if correction.Author == "" {
+		return fmt.Errorf("a correction needs an author")
+	}
+
+	values, err := Parse(correction)
+	if err != nil {
+		return err
+	}
+
+	adapter := internal.Adapter{Name: correction.Adapter}
+	before, err := Find(ctx, adapter, correction.RepositoryId, correction.Entity, correction.Id, store)
+	if err != nil {
+		return err
+	}
+
+	if correction.CorrectedAt.IsZero() {
+		correction.CorrectedAt = time.Now().UTC()
+	}
+
+	if err := store.ApplyCorrection(ctx, correction, values); err != nil {
+		return fmt.Errorf("%w: %w", ErrStore, err)
+	}
+
+	after, err := Find(ctx, adapter, correction.RepositoryId, correction.Entity, correction.Id, store)
+	if err != nil {
+		return err
+	}
+	failures := store.InsertChanges(ctx, history.Diff(correction.Adapter, correction.RepositoryId, correction.Entity,
+		history.Snapshot{correction.Id: history.Values(before)},
+		history.Snapshot{correction.Id: history.Values(after)},
+		history.SourceManual, correction.CorrectedAt))
+	if failures != nil {
+		return fmt.Errorf("%w: the correction was applied, but its changes weren't recorded: %w", ErrStore, storage.Join(failures))
+	}
+
+	return nil
+}
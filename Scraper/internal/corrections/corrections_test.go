@@ -0,0 +1,93 @@
+package corrections
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"thesis/scraper/internal/storage/memory"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		entity string
+		fields map[string]string
+		want   map[string]any
+		err    bool
+	}{
+		{"text", storage.EntityRepositories, map[string]string{"grouping_key": "team-a"}, map[string]any{"grouping_key": "team-a"}, false},
+		{"empty text", storage.EntityRepositories, map[string]string{"default_branch": ""}, map[string]any{"default_branch": ""}, false},
+		{"nullable text", storage.EntityIssues, map[string]string{"type": "bug"}, map[string]any{"type": "bug"}, false},
+		{"cleared text", storage.EntityIssues, map[string]string{"type": ""}, map[string]any{"type": nil}, false},
+		{"timestamp in UTC", storage.EntityIssues, map[string]string{"created_at": "2024-03-01T13:00:00+01:00"}, map[string]any{"created_at": at}, false},
+		{"cleared timestamp", storage.EntityPullRequests, map[string]string{"merged_at": ""}, map[string]any{"merged_at": nil}, false},
+		{"several fields", storage.EntityDeployments, map[string]string{"sha": "abc", "environment_id": ""}, map[string]any{"sha": "abc", "environment_id": nil}, false},
+		{"required timestamp", storage.EntityIssues, map[string]string{"created_at": ""}, nil, true},
+		{"invalid timestamp", storage.EntityIssues, map[string]string{"closed_at": "yesterday"}, nil, true},
+		{"unknown field", storage.EntityIssues, map[string]string{"title": "x"}, nil, true},
+		{"identifying field", storage.EntityDeployments, map[string]string{"id": "1"}, nil, true},
+		{"unknown entity", storage.EntityEnvironments, map[string]string{"name": "prod"}, nil, true},
+		{"no fields", storage.EntityRepositories, nil, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := Parse(internal.Correction{Entity: test.entity, Fields: test.fields})
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v, want an error: %v", test.name, err, test.err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Parse = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	ctx := context.Background()
+	github := internal.Adapter{Name: "GitHub"}
+	store := memory.NewStore()
+	store.InsertRepository(ctx, github, internal.Repository{Id: "1", FullName: "org/one", GroupingKey: "org/one"})
+	store.InsertRepository(ctx, github, internal.Repository{Id: "2", FullName: "org/two", GroupingKey: "org/two"})
+	issueType := "bug"
+	store.InsertIssues(ctx, github, internal.Repository{Id: "1"}, []internal.Issue{{WorkItem: internal.WorkItem{ID: "10"}, Type: &issueType}})
+
+	tests := []struct {
+		name      string
+		override  Override
+		owned     bool
+		applied   bool
+		unapplied bool
+	}{
+		{"changed field", Override{Adapter: "github", Entity: storage.EntityRepositories, Id: "1", Fields: map[string]string{"grouping_key": "team"}}, true, true, false},
+		{"unchanged field", Override{Adapter: "github", Repository: "1", Entity: storage.EntityIssues, Id: "10", Fields: map[string]string{"type": "bug"}}, true, false, false},
+		{"not owned", Override{Adapter: "github", Entity: storage.EntityRepositories, Id: "2", Fields: map[string]string{"grouping_key": "team"}}, false, false, false},
+		{"unknown adapter", Override{Adapter: "gitlab", Entity: storage.EntityRepositories, Id: "1", Fields: map[string]string{"grouping_key": "team"}}, true, false, true},
+		{"unknown item", Override{Adapter: "github", Repository: "1", Entity: storage.EntityIssues, Id: "11", Fields: map[string]string{"type": "bug"}}, true, false, true},
+		{"invalid field", Override{Adapter: "github", Entity: storage.EntityRepositories, Id: "1", Fields: map[string]string{"id": "3"}}, true, false, true},
+	}
+
+	for _, test := range tests {
+		repositoryId := test.override.Repository
+		if test.override.Entity == storage.EntityRepositories {
+			repositoryId = test.override.Id
+		}
+
+		before, _ := store.ListCorrections(ctx, github.Name, repositoryId)
+		owns := func(string, string) bool { return test.owned }
+
+		unapplied := ApplyOverrides(ctx, []Override{test.override}, []internal.Adapter{github}, owns, store)
+		if (len(unapplied) > 0) != test.unapplied {
+			t.Errorf("%s: unapplied = %v, want unapplied: %v", test.name, unapplied, test.unapplied)
+		}
+
+		after, _ := store.ListCorrections(ctx, github.Name, repositoryId)
+		if (len(after) > len(before)) != test.applied {
+			t.Errorf("%s: %d corrections before and %d after, want applied: %v", test.name, len(before), len(after), test.applied)
+		}
+	}
+}
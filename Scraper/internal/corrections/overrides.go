@@ -0,0 +1,117 @@
+package corrections
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"log/slog"
+	"os"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/history"
+	"thesis/scraper/internal/storage"
+)
+
+// OverridesAuthor is recorded as the author of corrections from the overrides
+// file.
+const OverridesAuthor = "overrides file"
+
+// Override is a correction kept in the overrides file. For repositories, the
+// repository can be left out.
+type Override struct {
+	Adapter    string            `yaml:"adapter"`
+	Repository string            `yaml:"repository,omitempty"`
+	Entity     string            `yaml:"entity"`
+	Id         string            `yaml:"id"`
+	Fields     map[string]string `yaml:"fields"`
+}
+
+// Unapplied is an override that wasn't applied, with the reason.
+type Unapplied struct {
+	Override
+	Err error
+}
+
+type overridesFile struct {
+	Overrides []Override `yaml:"overrides"`
+}
+
+// ReadOverrides reads the overrides file, which lists the corrections under
+// an overrides key.
+func ReadOverrides(path string) ([]Override, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file overridesFile
+	decoder := yaml.NewDecoder(f)
+	decoder.SetStrict(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("could not read the overrides file %s: %w", path, err)
+	}
+
+	return file.Overrides, nil
+}
+
+// ApplyOverrides corrects the items of the overrides whose repository is
+// owned by this instance. Only fields that differ from the stored values are
+// written, so the corrections only record actual changes. It returns the
+// overrides that are invalid, don't match anything or couldn't be applied.
+func ApplyOverrides(ctx context.Context, overrides []Override, adapters []internal.Adapter, owns func(adapter string, repositoryId string) bool, store storage.Store) (unapplied []Unapplied) {
+	for _, override := range overrides {
+		adapter, ok := findAdapter(adapters, override.Adapter)
+		if !ok {
+			unapplied = append(unapplied, Unapplied{override, fmt.Errorf("unknown adapter %q", override.Adapter)})
+			continue
+		}
+
+		correction := internal.Correction{
+			Adapter:      adapter.Name,
+			RepositoryId: override.Repository,
+			Entity:       override.Entity,
+			Id:           override.Id,
+			Fields:       override.Fields,
+			Author:       OverridesAuthor,
+		}
+		if correction.Entity == storage.EntityRepositories {
+			correction.RepositoryId = correction.Id
+		}
+
+		if !owns(adapter.Name, correction.RepositoryId) {
+			continue
+		}
+
+		values, err := Parse(correction)
+		if err != nil {
+			unapplied = append(unapplied, Unapplied{override, err})
+			continue
+		}
+
+		item, err := Find(ctx, adapter, correction.RepositoryId, correction.Entity, correction.Id, store)
+		if err != nil {
+			unapplied = append(unapplied, Unapplied{override, err})
+			continue
+		}
+
+		stored := history.Values(item)
+		changed := make(map[string]string)
+		for field, value := range values {
+			if history.Format(value) != stored[field] {
+				changed[field] = correction.Fields[field]
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		correction.Fields = changed
+		if err := Apply(ctx, correction, store); err != nil {
+			unapplied = append(unapplied, Unapplied{override, err})
+			continue
+		}
+		slog.Info("Applied override", "adapter", adapter.Name, "repository", correction.RepositoryId, "entity", correction.Entity, "id", correction.Id, "fields", len(changed))
+	}
+
+	return
+}
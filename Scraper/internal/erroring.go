@@ -1,9 +1,40 @@
 package internal
 
 import (
-	"log"
+	"log/slog"
+	"os"
+	"sync"
 )
 
+var fatalHooks []func(err error)
+var fatalHooksMutex sync.Mutex
+
 func ProcessError(err error) {
-	log.Fatal(err)
+	slog.Error("Fatal error", ErrorAttr(err))
+
+	fatalHooksMutex.Lock()
+	hooks := fatalHooks
+	fatalHooks = nil
+	fatalHooksMutex.Unlock()
+
+	for _, hook := range hooks {
+		hook(err)
+	}
+
+	os.Exit(1)
+}
+
+// OnFatal registers a hook that runs once before ProcessError exits, e.g. to
+// record the error somewhere more durable than the log.
+func OnFatal(hook func(err error)) {
+	fatalHooksMutex.Lock()
+	defer fatalHooksMutex.Unlock()
+
+	fatalHooks = append(fatalHooks, hook)
+}
+
+// ErrorAttr is the attribute every error is logged with, so failures can be
+// searched for by a single field.
+func ErrorAttr(err error) slog.Attr {
+	return slog.Any("error", err)
 }
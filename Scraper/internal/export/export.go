@@ -0,0 +1,252 @@
+// Package export writes the stored base data and metrics to CSV, JSONL or
+// Parquet files.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// TableChangeFailureRates holds one rate per grouping key, so unlike the other
+// tables it has no retention.
+const TableChangeFailureRates = "change_failure_rates"
+
+// Filter selects the exported rows. Empty fields match every row. From and To
+// are compared with the creation time of base data and the date of deployment
+// frequencies, From is inclusive and To is exclusive. The other metrics have no
+// date and aren't filtered by it.
+type Filter struct {
+	Repository  string
+	GroupingKey string
+	From        time.Time
+	To          time.Time
+}
+
+func (f Filter) matches(repo internal.Repository) bool {
+	return (f.Repository == "" || f.Repository == repo.Id) && (f.GroupingKey == "" || f.GroupingKey == repo.GroupingKey)
+}
+
+func (f Filter) inRange(t time.Time) bool {
+	return (f.From.IsZero() || !t.Before(f.From)) && (f.To.IsZero() || t.Before(f.To))
+}
+
+// table lists the rows of a table for the repositories of an adapter that
+// match the filter. row is an empty row, which defines the schema. A read error
+// stops the export, as the file would be missing rows.
+type table struct {
+	row  any
+	rows func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, store storage.Store) ([]any, error)
+}
+
+var tables = map[string]table{
+	storage.EntityRepositories: {Repository{}, func(_ context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, _ storage.Store) (rows []any, err error) {
+		for _, repo := range repos {
+			if filter.inRange(repo.CreatedAt) {
+				rows = append(rows, fromRepository(adapter.Name, repo))
+			}
+		}
+		return rows, nil
+	}},
+	storage.TableIssues: {Issue{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range repos {
+			issues, err := store.ListIssues(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, issue := range issues {
+				if filter.inRange(issue.CreatedAt) {
+					rows = append(rows, fromIssue(adapter.Name, repo.Id, issue))
+				}
+			}
+		}
+		return rows, nil
+	}},
+	storage.TableCommits: {Commit{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range repos {
+			commits, err := store.ListCommits(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, commit := range commits {
+				if filter.inRange(commit.CreatedAt) {
+					rows = append(rows, fromCommit(adapter.Name, repo.Id, commit))
+				}
+			}
+		}
+		return rows, nil
+	}},
+	storage.TablePullRequests: {PullRequest{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range repos {
+			pullRequests, err := store.ListPullRequests(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, pullRequest := range pullRequests {
+				if filter.inRange(pullRequest.CreatedAt) {
+					rows = append(rows, fromPullRequest(adapter.Name, repo.Id, pullRequest))
+				}
+			}
+		}
+		return rows, nil
+	}},
+	storage.TableDeployments: {Deployment{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range repos {
+			deployments, err := store.ListDeployments(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, deployment := range deployments {
+				if filter.inRange(deployment.CreatedAt) {
+					rows = append(rows, fromDeployment(adapter.Name, repo.Id, deployment))
+				}
+			}
+		}
+		return rows, nil
+	}},
+	storage.TableEnvironments: {Environment{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range repos {
+			environments, err := store.ListEnvironments(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, environment := range environments {
+				if filter.inRange(environment.CreatedAt) {
+					rows = append(rows, fromEnvironment(adapter.Name, repo.Id, environment))
+				}
+			}
+		}
+		return rows, nil
+	}},
+	storage.TableDeploymentFrequencies: {DeploymentFrequency{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, filter Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range repos {
+			frequencies, err := store.ListDeploymentFrequency(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, date := range sortedKeys(frequencies) {
+				day, err := time.Parse(time.DateOnly, date)
+				if err == nil && filter.inRange(day) {
+					rows = append(rows, DeploymentFrequency{adapter.Name, repo.GroupingKey, repo.Id, date, int64(frequencies[date])})
+				}
+			}
+		}
+		return rows, nil
+	}},
+	storage.TableLeadTimes: {LeadTime{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, _ Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range byGroupingKey(repos) {
+			leadTimes, err := store.ListLeadTimeForChange(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, issueId := range sortedKeys(leadTimes) {
+				rows = append(rows, LeadTime{adapter.Name, repo.GroupingKey, issueId, leadTimes[issueId].Milliseconds()})
+			}
+		}
+		return rows, nil
+	}},
+	TableChangeFailureRates: {ChangeFailureRate{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, _ Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range byGroupingKey(repos) {
+			rate, err := store.ListChangeFailureRate(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, ChangeFailureRate{adapter.Name, repo.GroupingKey, rate})
+		}
+		return rows, nil
+	}},
+	storage.TableTimesToRestoreService: {TimeToRestoreService{}, func(ctx context.Context, adapter internal.Adapter, repos []internal.Repository, _ Filter, store storage.Store) (rows []any, err error) {
+		for _, repo := range byGroupingKey(repos) {
+			timesToRestoreService, err := store.ListTimesToRestoreService(ctx, adapter, repo)
+			if err != nil {
+				return nil, err
+			}
+			for _, issueId := range sortedKeys(timesToRestoreService) {
+				rows = append(rows, TimeToRestoreService{adapter.Name, repo.GroupingKey, issueId, timesToRestoreService[issueId].Milliseconds()})
+			}
+		}
+		return rows, nil
+	}},
+}
+
+// Tables returns the tables that can be exported.
+func Tables() (names []string) {
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// Export writes the rows of a table that match the filter to w and returns how
+// many rows it wrote.
+func Export(ctx context.Context, name string, format string, adapters []internal.Adapter, filter Filter, w io.Writer, store storage.Store) (int, error) {
+	t, ok := tables[name]
+	if !ok {
+		return 0, fmt.Errorf("%q can't be exported, use one of %s", name, strings.Join(Tables(), ", "))
+	}
+
+	out, err := newWriter(format, t.row, w)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, adapter := range adapters {
+		stored, err := store.ListRepositories(ctx, adapter)
+		if err != nil {
+			return count, err
+		}
+
+		var repos []internal.Repository
+		for _, repo := range stored {
+			if filter.matches(repo) {
+				repos = append(repos, repo)
+			}
+		}
+		sort.Slice(repos, func(i, j int) bool { return repos[i].Id < repos[j].Id })
+
+		rows, err := t.rows(ctx, adapter, repos, filter, store)
+		if err != nil {
+			return count, err
+		}
+
+		for _, row := range rows {
+			if err := out.write(row); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	return count, out.close()
+}
+
+// byGroupingKey returns one repository per grouping key, as the metrics that
+// are stored per grouping key are the same for all of its repositories.
+func byGroupingKey(repos []internal.Repository) (unique []internal.Repository) {
+	seen := make(map[string]bool)
+	for _, repo := range repos {
+		if !seen[repo.GroupingKey] {
+			seen[repo.GroupingKey] = true
+			unique = append(unique, repo)
+		}
+	}
+
+	return
+}
+
+func sortedKeys[T any](m map[string]T) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return
+}
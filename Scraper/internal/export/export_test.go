@@ -0,0 +1,143 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"thesis/scraper/internal/storage/memory"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	adapters := []internal.Adapter{{Name: "github"}}
+	created := time.Date(2024, 3, 1, 12, 0, 0, 123000000, time.UTC)
+	closed := created.Add(48 * time.Hour)
+	issueType := "bug"
+
+	repo := internal.Repository{Id: "1", FullName: "org/one", DefaultBranch: "main", GroupingKey: "org", CreatedAt: created, UpdatedAt: closed}
+	environment := internal.Environment{Id: "e1", Name: "prod, eu", CreatedAt: created, UpdatedAt: closed}
+	commit := internal.Commit{Sha: "abc", Repo: &repo, CreatedAt: created}
+
+	source := memory.NewStore()
+	source.InsertRepository(ctx, adapters[0], repo)
+	source.InsertRepository(ctx, adapters[0], internal.Repository{Id: "2", FullName: "org/\"two\"", GroupingKey: "org", CreatedAt: created})
+	source.InsertIssues(ctx, adapters[0], repo, []internal.Issue{
+		{WorkItem: internal.WorkItem{ID: "10", CreatedAt: created, ClosedAt: &closed, Repo: &repo}, PullRequests: []string{"21", "20"}, Type: &issueType},
+		{WorkItem: internal.WorkItem{ID: "11", CreatedAt: created, Repo: &repo}},
+	})
+	source.InsertCommits(ctx, adapters[0], repo, []internal.Commit{commit})
+	source.InsertPullRequests(ctx, adapters[0], repo, []internal.PullRequest{
+		{WorkItem: internal.WorkItem{ID: "20", CreatedAt: created, ClosedAt: &closed, Repo: &repo}, MergedAt: &closed, Head: &internal.Head{Ref: "feature", Sha: "abc"}, Base: &internal.Head{Ref: "main", Sha: "def"}},
+	})
+	source.InsertEnvironments(ctx, adapters[0], repo, []internal.Environment{environment})
+	source.InsertDeployments(ctx, adapters[0], repo, []internal.Deployment{
+		{Id: "d1", Sha: "abc", Commit: &commit, Ref: "main", Task: "deploy", Environment: &environment, CreatedAt: created, UpdatedAt: closed},
+	})
+
+	for _, format := range []string{FormatCsv, FormatJsonl} {
+		target := memory.NewStore()
+
+		// The repositories are imported first, the other tables need them
+		for _, name := range ImportTables() {
+			if name == storage.EntityRepositories {
+				roundTrip(t, ctx, name, format, adapters, source, target)
+			}
+		}
+		for _, name := range ImportTables() {
+			if name != storage.EntityRepositories {
+				roundTrip(t, ctx, name, format, adapters, source, target)
+			}
+		}
+	}
+}
+
+// roundTrip imports the export of a table into target and checks that target
+// exports the same rows.
+func roundTrip(t *testing.T, ctx context.Context, name string, format string, adapters []internal.Adapter, source storage.Store, target storage.Store) {
+	var exported bytes.Buffer
+	count, err := Export(ctx, name, format, adapters, Filter{}, &exported, source)
+	if err != nil {
+		t.Fatalf("%s as %s: could not export: %v", name, format, err)
+	}
+	if count == 0 {
+		t.Fatalf("%s as %s: nothing was exported", name, format)
+	}
+
+	imported, err := Import(ctx, name, format, adapters, bytes.NewReader(exported.Bytes()), target)
+	if err != nil {
+		t.Fatalf("%s as %s: could not import: %v", name, format, err)
+	}
+	rows := 0
+	for _, i := range imported {
+		rows += i.Rows
+		if i.Failed > 0 {
+			t.Errorf("%s as %s: %d rows of %s failed", name, format, i.Failed, i.Repository.Id)
+		}
+	}
+	if rows != count {
+		t.Errorf("%s as %s: %d rows were imported, %d exported", name, format, rows, count)
+	}
+
+	var reexported bytes.Buffer
+	if _, err := Export(ctx, name, format, adapters, Filter{}, &reexported, target); err != nil {
+		t.Fatalf("%s as %s: could not export the import: %v", name, format, err)
+	}
+	if reexported.String() != exported.String() {
+		t.Errorf("%s as %s changed in the round trip:\n%s\nbecame\n%s", name, format, exported.String(), reexported.String())
+	}
+}
+
+func TestImportItems(t *testing.T) {
+	ctx := context.Background()
+	github := internal.Adapter{Name: "github"}
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	issueType := "bug"
+
+	repo := internal.Repository{Id: "1", FullName: "org/one", GroupingKey: "org", CreatedAt: created}
+	issues := []internal.Issue{
+		{WorkItem: internal.WorkItem{ID: "10", CreatedAt: created}, PullRequests: []string{"20"}, Type: &issueType},
+		{WorkItem: internal.WorkItem{ID: "11", CreatedAt: created}},
+	}
+
+	target := memory.NewStore()
+	if _, err := ImportItems(ctx, storage.EntityIssues, github, repo.Id, lines(t, issues), target); err == nil {
+		t.Error("the issues were imported without their repository")
+	}
+
+	if _, err := ImportItems(ctx, storage.EntityRepositories, github, "", lines(t, []internal.Repository{repo}), target); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportItems(ctx, storage.EntityIssues, github, repo.Id, lines(t, issues), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || imported[0].Rows != len(issues) || imported[0].Failed != 0 {
+		t.Errorf("imported %+v, want %d issues of %s", imported, len(issues), repo.Id)
+	}
+
+	stored, _ := target.ListIssues(ctx, github, repo)
+	if len(stored) != len(issues) || stored[0].Type == nil || *stored[0].Type != issueType || stored[0].PullRequests[0] != "20" {
+		t.Errorf("stored %+v, want %+v", stored, issues)
+	}
+
+	if _, err := ImportItems(ctx, storage.EntityIssues, github, repo.Id, bytes.NewBufferString(`{"created_at":"2024-03-01T12:00:00Z"}`), target); err == nil {
+		t.Error("an issue without an id was imported")
+	}
+}
+
+// lines encodes items as JSONL.
+func lines[T any](t *testing.T, items []T) *bytes.Buffer {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &buffer
+}
@@ -0,0 +1,391 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/history"
+	"thesis/scraper/internal/processing"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// FormatItems is a JSONL file of items shaped like the internal types, which
+// ImportItems reads.
+const FormatItems = "items"
+
+// items holds the imported items of one repository.
+type items struct {
+	repository   internal.Repository
+	issues       []internal.Issue
+	commits      []internal.Commit
+	pullRequests []internal.PullRequest
+	deployments  []internal.Deployment
+	environments []internal.Environment
+}
+
+// importers adds a row to the items of its repository. Metrics can't be
+// imported, they are calculated from the base data.
+var importers = map[string]func(row any, items *items){
+	storage.EntityRepositories: func(row any, items *items) {
+		items.repository = row.(Repository).toRepository()
+	},
+	storage.TableIssues: func(row any, items *items) {
+		items.issues = append(items.issues, row.(Issue).toIssue(&items.repository))
+	},
+	storage.TableCommits: func(row any, items *items) {
+		items.commits = append(items.commits, row.(Commit).toCommit(&items.repository))
+	},
+	storage.TablePullRequests: func(row any, items *items) {
+		items.pullRequests = append(items.pullRequests, row.(PullRequest).toPullRequest(&items.repository))
+	},
+	storage.TableDeployments: func(row any, items *items) {
+		items.deployments = append(items.deployments, row.(Deployment).toDeployment())
+	},
+	storage.TableEnvironments: func(row any, items *items) {
+		items.environments = append(items.environments, row.(Environment).toEnvironment())
+	},
+}
+
+// Imported counts the rows that were imported for a repository, and those of
+// them that could not be written.
+type Imported struct {
+	Adapter    internal.Adapter
+	Repository internal.Repository
+	Rows       int
+	Failed     int
+}
+
+// ImportTables returns the tables that can be imported.
+func ImportTables() (names []string) {
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// Import reads the rows of a base data table from a CSV or JSONL file with the
+// columns of an export and upserts them like a scrape does, so manually
+// corrected rows are kept and the changes are recorded in the history. Items
+// missing from the file are left alone. Every row is validated before anything
+// is written, and the repositories of the rows must already be stored, unless
+// the repositories themselves are imported.
+func Import(ctx context.Context, name string, format string, adapters []internal.Adapter, r io.Reader, store storage.Store) ([]Imported, error) {
+	add, ok := importers[name]
+	if !ok {
+		return nil, fmt.Errorf("%q can't be imported, use one of %s", name, strings.Join(ImportTables(), ", "))
+	}
+
+	rows, err := read(format, tables[name].row, r)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		adapter      internal.Adapter
+		repositoryId string
+		rows         []any
+		items        items
+	}
+	var groups []*group
+	byRepository := make(map[[2]string]*group)
+
+	for i, row := range rows {
+		adapterName, repositoryId, id := row.(baseRow).key()
+		adapter, ok := findAdapter(adapters, adapterName)
+		if !ok {
+			return nil, fmt.Errorf("row %d: unknown adapter %q", i+1, adapterName)
+		}
+		if repositoryId == "" || id == "" {
+			return nil, fmt.Errorf("row %d: the repository and the id are required", i+1)
+		}
+
+		k := [2]string{adapter.Name, repositoryId}
+		if byRepository[k] == nil {
+			byRepository[k] = &group{adapter: adapter, repositoryId: repositoryId}
+			groups = append(groups, byRepository[k])
+		}
+		byRepository[k].rows = append(byRepository[k].rows, row)
+	}
+
+	stored := make(map[string][]internal.Repository)
+	for _, g := range groups {
+		if name != storage.EntityRepositories {
+			if _, ok := stored[g.adapter.Name]; !ok {
+				repos, err := store.ListRepositories(ctx, g.adapter)
+				if err != nil {
+					return nil, err
+				}
+				stored[g.adapter.Name] = repos
+			}
+
+			repo, ok := findRepository(stored[g.adapter.Name], g.repositoryId)
+			if !ok {
+				return nil, fmt.Errorf("the repository %q of %s isn't stored, import the repositories first", g.repositoryId, g.adapter.Name)
+			}
+			g.items.repository = repo
+		}
+
+		for _, row := range g.rows {
+			add(row, &g.items)
+		}
+	}
+
+	var imported []Imported
+	for _, g := range groups {
+		imported = append(imported, Imported{Adapter: g.adapter, Repository: g.items.repository, Rows: len(g.rows), Failed: len(upsert(ctx, g.adapter, name, g.items, store))})
+	}
+
+	return imported, nil
+}
+
+// upsert writes the imported items. The repository is only written if the
+// repositories themselves are imported, otherwise it is already stored.
+func upsert(ctx context.Context, adapter internal.Adapter, name string, items items, store storage.Store) []storage.RowError {
+	if name == storage.EntityRepositories {
+		return processing.Upsert(ctx, adapter, items.repository, nil, nil, nil, nil, nil, history.SourceImport, store)
+	}
+
+	return processing.UpsertItems(ctx, adapter, items.repository, items.issues, items.commits, items.pullRequests, items.deployments, items.environments, history.SourceImport, store)
+}
+
+// ImportItems reads a JSONL file of items shaped like the internal types, as the
+// adapters and the API return them, and upserts them like Import. The items
+// don't carry their adapter and repository, so they are all imported into
+// repositoryId, which must already be stored. Repositories only need the
+// adapter.
+func ImportItems(ctx context.Context, name string, adapter internal.Adapter, repositoryId string, r io.Reader, store storage.Store) ([]Imported, error) {
+	if _, ok := importers[name]; !ok {
+		return nil, fmt.Errorf("%q can't be imported, use one of %s", name, strings.Join(ImportTables(), ", "))
+	}
+
+	if name == storage.EntityRepositories {
+		repos, err := readItems(r, func(repo internal.Repository) string { return repo.Id })
+		if err != nil {
+			return nil, err
+		}
+
+		var imported []Imported
+		for _, repo := range repos {
+			failures := upsert(ctx, adapter, name, items{repository: repo}, store)
+			imported = append(imported, Imported{Adapter: adapter, Repository: repo, Rows: 1, Failed: len(failures)})
+		}
+		return imported, nil
+	}
+
+	if repositoryId == "" {
+		return nil, fmt.Errorf("the repository of the %s is required", name)
+	}
+
+	stored, err := store.GetItem(ctx, adapter, repositoryId, storage.EntityRepositories, repositoryId)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("the repository %q of %s isn't stored, import the repositories first", repositoryId, adapter.Name)
+	}
+
+	imported := items{repository: stored.(internal.Repository)}
+	var rows int
+	switch name {
+	case storage.TableIssues:
+		imported.issues, err = readItems(r, func(issue internal.Issue) string { return issue.ID })
+		rows = len(imported.issues)
+	case storage.TableCommits:
+		imported.commits, err = readItems(r, func(commit internal.Commit) string { return commit.Sha })
+		rows = len(imported.commits)
+	case storage.TablePullRequests:
+		imported.pullRequests, err = readItems(r, func(pullRequest internal.PullRequest) string { return pullRequest.ID })
+		rows = len(imported.pullRequests)
+	case storage.TableDeployments:
+		imported.deployments, err = readItems(r, func(deployment internal.Deployment) string { return deployment.Id })
+		rows = len(imported.deployments)
+	case storage.TableEnvironments:
+		imported.environments, err = readItems(r, func(environment internal.Environment) string { return environment.Id })
+		rows = len(imported.environments)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	failures := upsert(ctx, adapter, name, imported, store)
+	return []Imported{{Adapter: adapter, Repository: imported.repository, Rows: rows, Failed: len(failures)}}, nil
+}
+
+// readItems decodes one item per line. Like the rows of Import, every item
+// needs an id.
+func readItems[T any](r io.Reader, id func(item T) string) (items []T, err error) {
+	decoder := json.NewDecoder(r)
+
+	for i := 1; ; i++ {
+		var item T
+		err := decoder.Decode(&item)
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		if id(item) == "" {
+			return nil, fmt.Errorf("row %d: the id is required", i)
+		}
+
+		items = append(items, item)
+	}
+}
+
+func findAdapter(adapters []internal.Adapter, name string) (internal.Adapter, bool) {
+	for _, adapter := range adapters {
+		if strings.EqualFold(adapter.Name, name) {
+			return adapter, true
+		}
+	}
+
+	return internal.Adapter{}, false
+}
+
+func findRepository(repos []internal.Repository, id string) (internal.Repository, bool) {
+	for _, repo := range repos {
+		if repo.Id == id {
+			return repo, true
+		}
+	}
+
+	return internal.Repository{}, false
+}
+
+// read decodes the rows of a file into values of the type of row.
+func read(format string, row any, r io.Reader) ([]any, error) {
+	switch format {
+	case FormatCsv:
+		return readCsv(reflect.TypeOf(row), r)
+	case FormatJsonl:
+		return readJsonl(reflect.TypeOf(row), r)
+	}
+
+	return nil, fmt.Errorf("%q files can't be imported, use %s or %s", format, FormatCsv, FormatJsonl)
+}
+
+func readJsonl(rowType reflect.Type, r io.Reader) (rows []any, err error) {
+	decoder := json.NewDecoder(r)
+
+	for i := 1; ; i++ {
+		row := reflect.New(rowType)
+		err := decoder.Decode(row.Interface())
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+
+		rows = append(rows, row.Elem().Interface())
+	}
+}
+
+// readCsv reads a CSV file with a header row. Columns may be in any order and
+// missing columns are left empty, so spreadsheets only need the columns they
+// have data for.
+func readCsv(rowType reflect.Type, r io.Reader) (rows []any, err error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the header: %w", err)
+	}
+
+	byColumn := make(map[string]int)
+	for i := 0; i < rowType.NumField(); i++ {
+		byColumn[column(rowType.Field(i))] = i
+	}
+
+	fields := make([]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		field, ok := byColumn[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, use %s", name, strings.Join(columns(rowType), ", "))
+		}
+		fields[i] = field
+	}
+
+	for i := 1; ; i++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		row := reflect.New(rowType).Elem()
+		for j, value := range record {
+			if err := setCsvValue(row.Field(fields[j]), value); err != nil {
+				return nil, fmt.Errorf("row %d, column %q: %w", i, header[j], err)
+			}
+		}
+		rows = append(rows, row.Interface())
+	}
+}
+
+// setCsvValue parses a value written by csvValue. Timestamps may also be plain
+// dates, which are midnight in UTC.
+func setCsvValue(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case *string:
+		if value != "" {
+			field.Set(reflect.ValueOf(&value))
+		}
+	case []string:
+		field.Set(reflect.ValueOf(strings.Fields(value)))
+	case int64:
+		number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(number)
+	case float64:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(number)
+	case time.Time:
+		t, err := parseTime(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+	case *time.Time:
+		if strings.TrimSpace(value) != "" {
+			t, err := parseTime(value)
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(&t))
+		}
+	default:
+		return fmt.Errorf("no CSV representation for %s", field.Type())
+	}
+
+	return nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), err
+}
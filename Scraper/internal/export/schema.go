@@ -0,0 +1,294 @@
+package export
+
+import (
+	"thesis/scraper/internal"
+	"time"
+)
+
+// The rows of each table, in the order of their columns. Columns are only ever
+// added at the end, so files of older exports keep their meaning. Docs/Export.md
+// documents the columns.
+
+// Repository is a row of the repositories table.
+type Repository struct {
+	Adapter       string    `json:"adapter" parquet:"adapter"`
+	Id            string    `json:"id" parquet:"id"`
+	FullName      string    `json:"full_name" parquet:"full_name"`
+	DefaultBranch string    `json:"default_branch" parquet:"default_branch"`
+	GroupingKey   string    `json:"grouping_key" parquet:"grouping_key"`
+	CreatedAt     time.Time `json:"created_at" parquet:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" parquet:"updated_at"`
+}
+
+// Issue is a row of the issues table.
+type Issue struct {
+	Adapter        string     `json:"adapter" parquet:"adapter"`
+	RepositoryId   string     `json:"repository_id" parquet:"repository_id"`
+	Id             string     `json:"id" parquet:"id"`
+	Type           *string    `json:"type" parquet:"type,optional"`
+	PullRequestIds []string   `json:"pull_request_ids" parquet:"pull_request_ids,list"`
+	CreatedAt      time.Time  `json:"created_at" parquet:"created_at"`
+	ClosedAt       *time.Time `json:"closed_at" parquet:"closed_at,optional"`
+}
+
+// Commit is a row of the commits table.
+type Commit struct {
+	Adapter      string    `json:"adapter" parquet:"adapter"`
+	RepositoryId string    `json:"repository_id" parquet:"repository_id"`
+	Sha          string    `json:"sha" parquet:"sha"`
+	CreatedAt    time.Time `json:"created_at" parquet:"created_at"`
+}
+
+// PullRequest is a row of the pull_requests table.
+type PullRequest struct {
+	Adapter      string     `json:"adapter" parquet:"adapter"`
+	RepositoryId string     `json:"repository_id" parquet:"repository_id"`
+	Id           string     `json:"id" parquet:"id"`
+	HeadRef      string     `json:"head_ref" parquet:"head_ref"`
+	HeadSha      string     `json:"head_sha" parquet:"head_sha"`
+	BaseRef      string     `json:"base_ref" parquet:"base_ref"`
+	BaseSha      string     `json:"base_sha" parquet:"base_sha"`
+	IssueIds     []string   `json:"issue_ids" parquet:"issue_ids,list"`
+	CommitShas   []string   `json:"commit_shas" parquet:"commit_shas,list"`
+	CreatedAt    time.Time  `json:"created_at" parquet:"created_at"`
+	ClosedAt     *time.Time `json:"closed_at" parquet:"closed_at,optional"`
+	MergedAt     *time.Time `json:"merged_at" parquet:"merged_at,optional"`
+}
+
+// Deployment is a row of the deployments table.
+type Deployment struct {
+	Adapter       string    `json:"adapter" parquet:"adapter"`
+	RepositoryId  string    `json:"repository_id" parquet:"repository_id"`
+	Id            string    `json:"id" parquet:"id"`
+	Sha           string    `json:"sha" parquet:"sha"`
+	Ref           string    `json:"ref" parquet:"ref"`
+	Task          string    `json:"task" parquet:"task"`
+	CommitSha     *string   `json:"commit_sha" parquet:"commit_sha,optional"`
+	EnvironmentId *string   `json:"environment_id" parquet:"environment_id,optional"`
+	CreatedAt     time.Time `json:"created_at" parquet:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" parquet:"updated_at"`
+}
+
+// Environment is a row of the environments table.
+type Environment struct {
+	Adapter      string    `json:"adapter" parquet:"adapter"`
+	RepositoryId string    `json:"repository_id" parquet:"repository_id"`
+	Id           string    `json:"id" parquet:"id"`
+	Name         string    `json:"name" parquet:"name"`
+	CreatedAt    time.Time `json:"created_at" parquet:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" parquet:"updated_at"`
+}
+
+// DeploymentFrequency is a row of the deployment_frequencies table.
+type DeploymentFrequency struct {
+	Adapter      string `json:"adapter" parquet:"adapter"`
+	GroupingKey  string `json:"grouping_key" parquet:"grouping_key"`
+	RepositoryId string `json:"repository_id" parquet:"repository_id"`
+	Date         string `json:"date" parquet:"date"`
+	Deployments  int64  `json:"deployments" parquet:"deployments"`
+}
+
+// LeadTime is a row of the lead_times table.
+type LeadTime struct {
+	Adapter      string `json:"adapter" parquet:"adapter"`
+	GroupingKey  string `json:"grouping_key" parquet:"grouping_key"`
+	IssueId      string `json:"issue_id" parquet:"issue_id"`
+	Milliseconds int64  `json:"lead_time_ms" parquet:"lead_time_ms"`
+}
+
+// ChangeFailureRate is a row of the change_failure_rates table.
+type ChangeFailureRate struct {
+	Adapter     string  `json:"adapter" parquet:"adapter"`
+	GroupingKey string  `json:"grouping_key" parquet:"grouping_key"`
+	Rate        float64 `json:"rate" parquet:"rate"`
+}
+
+// TimeToRestoreService is a row of the times_to_restore_service table.
+type TimeToRestoreService struct {
+	Adapter      string `json:"adapter" parquet:"adapter"`
+	GroupingKey  string `json:"grouping_key" parquet:"grouping_key"`
+	IssueId      string `json:"issue_id" parquet:"issue_id"`
+	Milliseconds int64  `json:"time_to_restore_service_ms" parquet:"time_to_restore_service_ms"`
+}
+
+func fromRepository(adapter string, repo internal.Repository) Repository {
+	return Repository{
+		Adapter:       adapter,
+		Id:            repo.Id,
+		FullName:      repo.FullName,
+		DefaultBranch: repo.DefaultBranch,
+		GroupingKey:   repo.GroupingKey,
+		CreatedAt:     repo.CreatedAt.UTC(),
+		UpdatedAt:     repo.UpdatedAt.UTC(),
+	}
+}
+
+func fromIssue(adapter string, repositoryId string, issue internal.Issue) Issue {
+	return Issue{
+		Adapter:        adapter,
+		RepositoryId:   repositoryId,
+		Id:             issue.ID,
+		Type:           issue.Type,
+		PullRequestIds: append([]string{}, issue.PullRequests...),
+		CreatedAt:      issue.CreatedAt.UTC(),
+		ClosedAt:       utc(issue.ClosedAt),
+	}
+}
+
+func fromCommit(adapter string, repositoryId string, commit internal.Commit) Commit {
+	return Commit{
+		Adapter:      adapter,
+		RepositoryId: repositoryId,
+		Sha:          commit.Sha,
+		CreatedAt:    commit.CreatedAt.UTC(),
+	}
+}
+
+func fromPullRequest(adapter string, repositoryId string, pullRequest internal.PullRequest) PullRequest {
+	row := PullRequest{
+		Adapter:      adapter,
+		RepositoryId: repositoryId,
+		Id:           pullRequest.ID,
+		IssueIds:     []string{},
+		CommitShas:   []string{},
+		CreatedAt:    pullRequest.CreatedAt.UTC(),
+		ClosedAt:     utc(pullRequest.ClosedAt),
+		MergedAt:     utc(pullRequest.MergedAt),
+	}
+	if pullRequest.Head != nil {
+		row.HeadRef, row.HeadSha = pullRequest.Head.Ref, pullRequest.Head.Sha
+	}
+	if pullRequest.Base != nil {
+		row.BaseRef, row.BaseSha = pullRequest.Base.Ref, pullRequest.Base.Sha
+	}
+	for _, issue := range pullRequest.Issues {
+		row.IssueIds = append(row.IssueIds, issue.ID)
+	}
+	for _, commit := range pullRequest.Commits {
+		row.CommitShas = append(row.CommitShas, commit.Sha)
+	}
+
+	return row
+}
+
+func fromDeployment(adapter string, repositoryId string, deployment internal.Deployment) Deployment {
+	row := Deployment{
+		Adapter:      adapter,
+		RepositoryId: repositoryId,
+		Id:           deployment.Id,
+		Sha:          deployment.Sha,
+		Ref:          deployment.Ref,
+		Task:         deployment.Task,
+		CreatedAt:    deployment.CreatedAt.UTC(),
+		UpdatedAt:    deployment.UpdatedAt.UTC(),
+	}
+	if deployment.Commit != nil {
+		row.CommitSha = &deployment.Commit.Sha
+	}
+	if deployment.Environment != nil {
+		row.EnvironmentId = &deployment.Environment.Id
+	}
+
+	return row
+}
+
+func fromEnvironment(adapter string, repositoryId string, environment internal.Environment) Environment {
+	return Environment{
+		Adapter:      adapter,
+		RepositoryId: repositoryId,
+		Id:           environment.Id,
+		Name:         environment.Name,
+		CreatedAt:    environment.CreatedAt.UTC(),
+		UpdatedAt:    environment.UpdatedAt.UTC(),
+	}
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	value := t.UTC()
+	return &value
+}
+
+// baseRow is a row of a base data table, which can be imported.
+type baseRow interface {
+	// key returns the adapter, the repository and the id of the row.
+	key() (adapter string, repositoryId string, id string)
+}
+
+func (r Repository) key() (string, string, string)  { return r.Adapter, r.Id, r.Id }
+func (r Issue) key() (string, string, string)       { return r.Adapter, r.RepositoryId, r.Id }
+func (r Commit) key() (string, string, string)      { return r.Adapter, r.RepositoryId, r.Sha }
+func (r PullRequest) key() (string, string, string) { return r.Adapter, r.RepositoryId, r.Id }
+func (r Deployment) key() (string, string, string)  { return r.Adapter, r.RepositoryId, r.Id }
+func (r Environment) key() (string, string, string) { return r.Adapter, r.RepositoryId, r.Id }
+
+func (r Repository) toRepository() internal.Repository {
+	return internal.Repository{
+		Id:            r.Id,
+		FullName:      r.FullName,
+		DefaultBranch: r.DefaultBranch,
+		GroupingKey:   r.GroupingKey,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+}
+
+func (r Issue) toIssue(repo *internal.Repository) internal.Issue {
+	return internal.Issue{
+		WorkItem:     internal.WorkItem{ID: r.Id, CreatedAt: r.CreatedAt, ClosedAt: r.ClosedAt, Repo: repo},
+		PullRequests: r.PullRequestIds,
+		Type:         r.Type,
+	}
+}
+
+func (r Commit) toCommit(repo *internal.Repository) internal.Commit {
+	return internal.Commit{Sha: r.Sha, Repo: repo, CreatedAt: r.CreatedAt}
+}
+
+func (r PullRequest) toPullRequest(repo *internal.Repository) internal.PullRequest {
+	pullRequest := internal.PullRequest{
+		WorkItem: internal.WorkItem{ID: r.Id, CreatedAt: r.CreatedAt, ClosedAt: r.ClosedAt, Repo: repo},
+		Head:     &internal.Head{Ref: r.HeadRef, Sha: r.HeadSha},
+		Base:     &internal.Head{Ref: r.BaseRef, Sha: r.BaseSha},
+		MergedAt: r.MergedAt,
+	}
+	for _, id := range r.IssueIds {
+		pullRequest.Issues = append(pullRequest.Issues, internal.Issue{WorkItem: internal.WorkItem{ID: id, Repo: repo}})
+	}
+	for _, sha := range r.CommitShas {
+		pullRequest.Commits = append(pullRequest.Commits, internal.Commit{Sha: sha, Repo: repo})
+	}
+
+	return pullRequest
+}
+
+func (r Deployment) toDeployment() internal.Deployment {
+	deployment := internal.Deployment{
+		Id:        r.Id,
+		Sha:       r.Sha,
+		Ref:       r.Ref,
+		Task:      r.Task,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+	if r.CommitSha != nil {
+		deployment.Commit = &internal.Commit{Sha: *r.CommitSha}
+	}
+	if r.EnvironmentId != nil {
+		deployment.Environment = &internal.Environment{Id: *r.EnvironmentId}
+	}
+
+	return deployment
+}
+
+func (r Environment) toEnvironment() internal.Environment {
+	return internal.Environment{
+		Id:        r.Id,
+		Name:      r.Name,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
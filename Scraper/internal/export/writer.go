@@ -0,0 +1,131 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/parquet-go/parquet-go"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The formats tables can be exported to
+const (
+	FormatCsv     = "csv"
+	FormatJsonl   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+type writer interface {
+	write(row any) error
+	close() error
+}
+
+func newWriter(format string, row any, w io.Writer) (writer, error) {
+	switch format {
+	case FormatCsv:
+		out := &csvWriter{csv.NewWriter(w)}
+		return out, out.csv.Write(columns(reflect.TypeOf(row)))
+	case FormatJsonl:
+		return jsonlWriter{json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return parquetWriter{parquet.NewWriter(w, parquet.SchemaOf(row))}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q, use one of %s, %s or %s", format, FormatCsv, FormatJsonl, FormatParquet)
+}
+
+// columns returns the names of the columns of a row, which are the same in all
+// formats.
+func columns(rowType reflect.Type) (names []string) {
+	for i := 0; i < rowType.NumField(); i++ {
+		names = append(names, column(rowType.Field(i)))
+	}
+
+	return
+}
+
+func column(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+// csvWriter writes timestamps as RFC 3339 and lists separated by spaces. Null
+// values are empty.
+type csvWriter struct {
+	csv *csv.Writer
+}
+
+func (c *csvWriter) write(row any) error {
+	value := reflect.ValueOf(row)
+
+	var record []string
+	for i := 0; i < value.NumField(); i++ {
+		field, err := csvValue(value.Field(i).Interface())
+		if err != nil {
+			return err
+		}
+		record = append(record, field)
+	}
+
+	return c.csv.Write(record)
+}
+
+func (c *csvWriter) close() error {
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+func csvValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case *string:
+		if v == nil {
+			return "", nil
+		}
+		return *v, nil
+	case []string:
+		return strings.Join(v, " "), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	}
+
+	return "", fmt.Errorf("no CSV representation for %T", value)
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j jsonlWriter) write(row any) error {
+	return j.encoder.Encode(row)
+}
+
+func (j jsonlWriter) close() error {
+	return nil
+}
+
+type parquetWriter struct {
+	parquet *parquet.Writer
+}
+
+func (p parquetWriter) write(row any) error {
+	return p.parquet.Write(row)
+}
+
+func (p parquetWriter) close() error {
+	return p.parquet.Close()
+}
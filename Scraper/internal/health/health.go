@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/basedatabase"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+const (
+	StatusOk          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+var checkTimeout = 3 * time.Second
+
+type Check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+// LivenessHandler answers as long as the process is able to serve requests.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Report{Status: StatusOk})
+	})
+}
+
+// ReadinessHandler checks every dependency a run needs and reports each one
+// separately. It answers with 503 if any of them is unavailable. The base
+// database is optional, so it is only checked if baseClient is set.
+func ReadinessHandler(adapters []internal.Adapter, store storage.Store, baseClient *basedatabase.DatabaseClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		report := Report{Status: StatusOk, Checks: make(map[string]Check)}
+		mutex := sync.Mutex{}
+		group := sync.WaitGroup{}
+
+		record := func(name string, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				report.Status = StatusUnavailable
+				report.Checks[name] = Check{Status: StatusUnavailable, Error: err.Error()}
+			} else {
+				report.Checks[name] = Check{Status: StatusOk}
+			}
+		}
+
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			record("storage", store.Ping(ctx))
+		}()
+
+		if baseClient != nil {
+			group.Add(1)
+			go func() {
+				defer group.Done()
+				record("basedatabase", basedatabase.Ping(ctx, baseClient))
+			}()
+		}
+
+		for _, adapter := range adapters {
+			group.Add(1)
+			go func(adapter internal.Adapter) {
+				defer group.Done()
+				record("adapter:"+strings.ToLower(adapter.Name), checkAdapter(ctx, adapter))
+			}(adapter)
+		}
+
+		group.Wait()
+
+		writeReport(w, report)
+	})
+}
+
+// checkAdapter only requires the adapter to answer at all, since the root path
+// is not part of the adapter API.
+func checkAdapter(ctx context.Context, adapter internal.Adapter) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", adapter.BaseUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("adapter answered with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOk {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		slog.Warn("Could not write health report", internal.ErrorAttr(err))
+	}
+}
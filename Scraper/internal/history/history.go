@@ -0,0 +1,177 @@
+package history
+
+import (
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"time"
+)
+
+// The sources of a change
+const (
+	SourceScrape = "scrape"
+	SourceManual = "manual"
+	SourceImport = "import"
+)
+
+// Snapshot maps the id of each item to the values of its tracked fields.
+type Snapshot map[string]map[string]string
+
+// Take records the tracked fields of items.
+func Take[T any](items []T, id func(T) string) Snapshot {
+	snapshot := make(Snapshot)
+	for _, item := range items {
+		snapshot[id(item)] = Values(item)
+	}
+
+	return snapshot
+}
+
+// Diff returns a change for every field that differs between the snapshots.
+// Items that were only added or removed are not changes.
+func Diff(adapter string, repositoryId string, entity string, before Snapshot, after Snapshot, source string, changedAt time.Time) (changes []internal.Change) {
+	var ids []string
+	for id := range after {
+		if _, ok := before[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		var fields []string
+		for field := range after[id] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			old, new := before[id][field], after[id][field]
+			if old == new {
+				continue
+			}
+
+			changes = append(changes, internal.Change{
+				Adapter:      adapter,
+				RepositoryId: repositoryId,
+				Entity:       entity,
+				Id:           id,
+				Field:        field,
+				OldValue:     old,
+				NewValue:     new,
+				Source:       source,
+				ChangedAt:    changedAt,
+			})
+		}
+	}
+
+	return
+}
+
+// Overwritten returns the changes of the tracked fields of stored items that
+// were overwritten by the written items with the same id. Stored items must
+// only be those an upsert actually replaced. The caller sets the source and the
+// time of the changes.
+func Overwritten[T any](adapter string, repositoryId string, entity string, stored []T, written []T) []internal.Change {
+	id := func(item T) string { return Id(item) }
+	return Diff(adapter, repositoryId, entity, Take(stored, id), Take(written, id), "", time.Time{})
+}
+
+// Id returns the id of an item with tracked fields.
+func Id(item any) string {
+	switch item := item.(type) {
+	case internal.Repository:
+		return item.Id
+	case internal.Issue:
+		return item.ID
+	case internal.PullRequest:
+		return item.ID
+	case internal.Deployment:
+		return item.Id
+	case internal.Environment:
+		return item.Id
+	}
+
+	return ""
+}
+
+// Values returns the tracked fields of an item as text. Missing values are
+// empty, timestamps are RFC 3339 in UTC with the milliseconds Cassandra keeps,
+// so fetched and stored items compare equal.
+func Values(item any) map[string]string {
+	switch item := item.(type) {
+	case internal.Repository:
+		return map[string]string{
+			"full_name":      item.FullName,
+			"default_branch": item.DefaultBranch,
+			"grouping_key":   item.GroupingKey,
+		}
+	case internal.Issue:
+		return map[string]string{
+			"type":          Format(item.Type),
+			"created_at":    Format(item.CreatedAt),
+			"closed_at":     Format(item.ClosedAt),
+			"pull_requests": formatIds(item.PullRequests),
+		}
+	case internal.PullRequest:
+		return map[string]string{
+			"created_at": Format(item.CreatedAt),
+			"closed_at":  Format(item.ClosedAt),
+			"merged_at":  Format(item.MergedAt),
+		}
+	case internal.Deployment:
+		values := map[string]string{
+			"sha":            item.Sha,
+			"ref":            item.Ref,
+			"task":           item.Task,
+			"commit_id":      "",
+			"environment_id": "",
+			"created_at":     Format(item.CreatedAt),
+			"updated_at":     Format(item.UpdatedAt),
+		}
+		if item.Commit != nil {
+			values["commit_id"] = item.Commit.Sha
+		}
+		if item.Environment != nil {
+			values["environment_id"] = item.Environment.Id
+		}
+		return values
+	case internal.Environment:
+		return map[string]string{
+			"name":       item.Name,
+			"created_at": Format(item.CreatedAt),
+			"updated_at": Format(item.UpdatedAt),
+		}
+	}
+
+	return nil
+}
+
+// Format returns a field value as it is recorded in the history.
+func Format(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case *string:
+		if value != nil {
+			return *value
+		}
+	case time.Time:
+		if !value.IsZero() {
+			return value.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano)
+		}
+	case *time.Time:
+		if value != nil {
+			return Format(*value)
+		}
+	}
+
+	return ""
+}
+
+func formatIds(ids []string) string {
+	sorted := append([]string{}, ids...)
+	sort.Strings(sorted)
+
+	return strings.Join(sorted, ",")
+}
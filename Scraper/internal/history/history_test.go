@@ -0,0 +1,87 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"thesis/scraper/internal"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	changedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	change := func(id string, field string, old string, new string) internal.Change {
+		return internal.Change{Adapter: "github", RepositoryId: "1", Entity: "environments", Id: id, Field: field, OldValue: old, NewValue: new, Source: SourceScrape, ChangedAt: changedAt}
+	}
+
+	tests := []struct {
+		name   string
+		before Snapshot
+		after  Snapshot
+		want   []internal.Change
+	}{
+		{"empty", Snapshot{}, Snapshot{}, nil},
+		{"unchanged", Snapshot{"a": {"name": "prod"}}, Snapshot{"a": {"name": "prod"}}, nil},
+		{"added item", Snapshot{}, Snapshot{"a": {"name": "prod"}}, nil},
+		{"removed item", Snapshot{"a": {"name": "prod"}}, Snapshot{}, nil},
+		{"changed field", Snapshot{"a": {"name": "prod"}}, Snapshot{"a": {"name": "production"}}, []internal.Change{
+			change("a", "name", "prod", "production"),
+		}},
+		{"set field", Snapshot{"a": {"name": ""}}, Snapshot{"a": {"name": "prod"}}, []internal.Change{
+			change("a", "name", "", "prod"),
+		}},
+		{"sorted by id and field", Snapshot{
+			"b": {"name": "b", "updated_at": "1"},
+			"a": {"name": "a", "updated_at": "1"},
+		}, Snapshot{
+			"b": {"updated_at": "2", "name": "c"},
+			"a": {"updated_at": "2", "name": "a"},
+		}, []internal.Change{
+			change("a", "updated_at", "1", "2"),
+			change("b", "name", "b", "c"),
+			change("b", "updated_at", "1", "2"),
+		}},
+	}
+
+	for _, test := range tests {
+		got := Diff("github", "1", "environments", test.before, test.after, SourceScrape, changedAt)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Diff = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOverwritten(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	stored := []internal.Environment{{Id: "a", Name: "prod", CreatedAt: created}, {Id: "b", Name: "staging"}}
+	written := []internal.Environment{{Id: "a", Name: "production", CreatedAt: created.Add(time.Microsecond)}, {Id: "c", Name: "dev"}}
+
+	want := []internal.Change{{Adapter: "github", RepositoryId: "1", Entity: "environments", Id: "a", Field: "name", OldValue: "prod", NewValue: "production"}}
+	if got := Overwritten("github", "1", "environments", stored, written); !reflect.DeepEqual(got, want) {
+		t.Errorf("Overwritten = %v, want %v", got, want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	text := "text"
+	at := time.Date(2024, 3, 1, 13, 0, 0, 123456789, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"text", "text"},
+		{&text, "text"},
+		{(*string)(nil), ""},
+		{at, "2024-03-01T12:00:00.123Z"},
+		{&at, "2024-03-01T12:00:00.123Z"},
+		{time.Time{}, ""},
+		{(*time.Time)(nil), ""},
+		{42, ""},
+	}
+
+	for _, test := range tests {
+		if got := Format(test.value); got != test.want {
+			t.Errorf("Format(%v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+func ConfigureLogging(config LoggingConfig) {
+	var level slog.Level
+	if config.Level != "" {
+		err := level.UnmarshalText([]byte(config.Level))
+		if err != nil {
+			ProcessError(err)
+		}
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// NewRunId returns a random id that ties together all log lines of one run.
+func NewRunId() string {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		ProcessError(err)
+	}
+
+	return hex.EncodeToString(id)
+}
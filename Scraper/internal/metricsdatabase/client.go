@@ -1,29 +1,44 @@
 package metricsdatabase
 
 import (
+	"context"
+	"fmt"
 	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"thesis/scraper/internal"
+	"thesis/scraper/internal/history"
+	"thesis/scraper/internal/storage"
+	"thesis/scraper/internal/tracing"
 	"time"
 )
 
 type DatabaseClient struct {
-	config  internal.DatabaseConfig
-	cluster *gocql.ClusterConfig
-	session *gocql.Session
+	config          internal.DatabaseConfig
+	cluster         *gocql.ClusterConfig
+	session         *gocql.Session
+	recorder        *Recorder
+	readConsistency gocql.Consistency
+	retention       map[string]time.Duration
 }
 
 var chunkSize = 50
 
 func CreateClient(config internal.DatabaseConfig) *DatabaseClient {
-	cluster := gocql.NewCluster(config.Hosts...)
-	//cluster.Keyspace = config.Keyspace
-	cluster.Authenticator = gocql.PasswordAuthenticator{
-		Username: config.Username,
-		Password: config.Password,
+	cluster, err := newCluster(config)
+	if err != nil {
+		internal.ProcessError(err)
+		return nil
+	}
+
+	reads, err := readConsistency(config, cluster)
+	if err != nil {
+		internal.ProcessError(err)
+		return nil
 	}
-	cluster.ProtoVersion = 3
 
-	return &DatabaseClient{config: config, cluster: cluster}
+	return &DatabaseClient{config: config, cluster: cluster, readConsistency: reads}
 }
 
 func Connect(client *DatabaseClient) {
@@ -39,50 +54,103 @@ func Connect(client *DatabaseClient) {
 	}
 }
 
-func InsertRepository(adapter internal.Adapter, repository internal.Repository, client *DatabaseClient) {
+func InsertRepository(ctx context.Context, adapter internal.Adapter, repository internal.Repository, client *DatabaseClient) ([]internal.Change, []storage.RowError) {
+	ctx, span := startSpan(ctx, "InsertRepository", adapter, repository)
+	defer span.End()
+
 	insertValues := [2]any{adapter.Name, repository.Id}
+	updateStatement := "UPDATE base_data.repositories SET full_name = ?, default_branch = ?, grouping_key = ?, created_at = ?, updated_at = ?, manually_corrected = false WHERE adapter = ? AND id = ? IF manually_corrected != true"
 	updateValues := [7]any{repository.FullName, repository.DefaultBranch, repository.GroupingKey, repository.CreatedAt, repository.UpdatedAt, adapter.Name, repository.Id}
 
-	Upsert(client,
+	// Without the stored grouping key the lookup tables can't be updated, so
+	// the repository isn't written until the next scrape
+	stored, corrected, err := storedRepository(ctx, client, adapter.Name, repository.Id)
+	if err != nil {
+		return nil, reportFailures(span, []storage.RowError{{Statement: qualify(client, updateStatement), Args: updateValues[:], Err: err}})
+	}
+
+	var previous *string
+	var overwritten []internal.Repository
+	if stored != nil {
+		previous = &stored.GroupingKey
+		if !corrected {
+			overwritten = append(overwritten, *stored)
+		}
+	}
+
+	failures := Upsert(ctx, client,
 		"INSERT INTO base_data.repositories (adapter, id) VALUES (?,?)",
 		insertValues[:],
-		"UPDATE base_data.repositories SET full_name = ?, default_branch = ?, grouping_key = ?, created_at = ?, updated_at = ?, manually_corrected = false WHERE adapter = ? AND id = ? IF manually_corrected != true",
+		updateStatement,
 		updateValues[:])
+
+	failures = append(failures, indexRepository(ctx, client, adapter.Name, repository.Id, previous)...)
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityRepositories, overwritten, []internal.Repository{repository}), failures
 }
 
-func InsertIssues(adapter internal.Adapter, repository internal.Repository, issues []internal.Issue, client *DatabaseClient) {
+func InsertIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository, issues []internal.Issue, client *DatabaseClient) ([]internal.Change, []storage.RowError) {
+	ctx, span := startSpan(ctx, "InsertIssues", adapter, repository)
+	defer span.End()
+
+	stored := overwritten(issues, func(ids []string) ([]internal.Issue, error) {
+		return listIssues(ctx, adapter, client, repository, ids, false)
+	})
+
 	var insertValues [][]any
 	var updateValues [][]any
 
 	for _, issue := range issues {
-		insertValues = append(insertValues, []any{adapter.Name, repository.Id, issue.ID})
-		updateValues = append(updateValues, []any{issue.Type, issue.PullRequests, issue.CreatedAt, issue.ClosedAt, adapter.Name, repository.Id, issue.ID})
+		rowTtl, keep := ttl(client, storage.TableIssues, issue.CreatedAt)
+		if !keep {
+			continue
+		}
+		insertValues = append(insertValues, []any{adapter.Name, repository.Id, issue.ID, rowTtl})
+		updateValues = append(updateValues, []any{rowTtl, issue.Type, issue.PullRequests, issue.CreatedAt, issue.ClosedAt, adapter.Name, repository.Id, issue.ID})
 	}
 
-	UpsertBatch(client,
-		"INSERT INTO base_data.issues (adapter, repository_id, id) VALUES (?,?,?)",
+	failures := UpsertBatch(ctx, client,
+		"INSERT INTO base_data.issues (adapter, repository_id, id) VALUES (?,?,?) USING TTL ?",
 		insertValues,
-		"UPDATE base_data.issues SET type = ?, pull_request_ids = ?, created_at = ?, closed_at = ?, manually_corrected = false WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
+		"UPDATE base_data.issues USING TTL ? SET type = ?, pull_request_ids = ?, created_at = ?, closed_at = ?, manually_corrected = false, deleted_at = null WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
 		updateValues)
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityIssues, stored, issues), failures
 }
 
-func InsertCommits(adapter internal.Adapter, repository internal.Repository, commits []internal.Commit, client *DatabaseClient) {
+func InsertCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository, commits []internal.Commit, client *DatabaseClient) []storage.RowError {
+	ctx, span := startSpan(ctx, "InsertCommits", adapter, repository)
+	defer span.End()
+
 	var insertValues [][]any
 	var updateValues [][]any
 
 	for _, commit := range commits {
-		insertValues = append(insertValues, []any{adapter.Name, repository.Id, commit.Sha})
-		updateValues = append(updateValues, []any{commit.CreatedAt, adapter.Name, repository.Id, commit.Sha})
+		rowTtl, keep := ttl(client, storage.TableCommits, commit.CreatedAt)
+		if !keep {
+			continue
+		}
+		insertValues = append(insertValues, []any{adapter.Name, repository.Id, commit.Sha, rowTtl})
+		updateValues = append(updateValues, []any{rowTtl, commit.CreatedAt, adapter.Name, repository.Id, commit.Sha})
 	}
 
-	UpsertBatch(client,
-		"INSERT INTO base_data.commits (adapter, repository_id, id) VALUES (?,?,?)",
+	failures := UpsertBatch(ctx, client,
+		"INSERT INTO base_data.commits (adapter, repository_id, id) VALUES (?,?,?) USING TTL ?",
 		insertValues,
-		"UPDATE base_data.commits SET created_at = ?, manually_corrected = false WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
+		"UPDATE base_data.commits USING TTL ? SET created_at = ?, manually_corrected = false WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
 		updateValues)
+
+	return failures
 }
 
-func InsertPullRequests(adapter internal.Adapter, repository internal.Repository, pullRequests []internal.PullRequest, client *DatabaseClient) {
+func InsertPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository, pullRequests []internal.PullRequest, client *DatabaseClient) ([]internal.Change, []storage.RowError) {
+	ctx, span := startSpan(ctx, "InsertPullRequests", adapter, repository)
+	defer span.End()
+
+	stored := overwritten(pullRequests, func(ids []string) ([]internal.PullRequest, error) {
+		return listPullRequests(ctx, adapter, client, repository, ids, false)
+	})
+
 	var insertValues [][]any
 	var updateValues [][]any
 
@@ -98,18 +166,31 @@ func InsertPullRequests(adapter internal.Adapter, repository internal.Repository
 			commitIds = append(commitIds, commit.Sha)
 		}
 
-		insertValues = append(insertValues, []any{adapter.Name, repository.Id, pullRequest.ID})
-		updateValues = append(updateValues, []any{pullRequest.Head, pullRequest.Base, issueIds, commitIds, pullRequest.ClosedAt, pullRequest.MergedAt, pullRequest.CreatedAt, adapter.Name, repository.Id, pullRequest.ID})
+		rowTtl, keep := ttl(client, storage.TablePullRequests, pullRequest.CreatedAt)
+		if !keep {
+			continue
+		}
+		insertValues = append(insertValues, []any{adapter.Name, repository.Id, pullRequest.ID, rowTtl})
+		updateValues = append(updateValues, []any{rowTtl, pullRequest.Head, pullRequest.Base, issueIds, commitIds, pullRequest.ClosedAt, pullRequest.MergedAt, pullRequest.CreatedAt, adapter.Name, repository.Id, pullRequest.ID})
 	}
 
-	UpsertBatch(client,
-		"INSERT INTO base_data.pull_requests (adapter, repository_id, id) VALUES (?,?,?)",
+	failures := UpsertBatch(ctx, client,
+		"INSERT INTO base_data.pull_requests (adapter, repository_id, id) VALUES (?,?,?) USING TTL ?",
 		insertValues,
-		"UPDATE base_data.pull_requests SET head = ?, base = ?, issue_ids = ?, commit_ids = ?, closed_at = ?, merged_at = ?, created_at = ?, manually_corrected = false WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
+		"UPDATE base_data.pull_requests USING TTL ? SET head = ?, base = ?, issue_ids = ?, commit_ids = ?, closed_at = ?, merged_at = ?, created_at = ?, manually_corrected = false, deleted_at = null WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
 		updateValues)
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityPullRequests, stored, pullRequests), failures
 }
 
-func InsertDeployments(adapter internal.Adapter, repository internal.Repository, deployments []internal.Deployment, client *DatabaseClient) {
+func InsertDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, deployments []internal.Deployment, client *DatabaseClient) ([]internal.Change, []storage.RowError) {
+	ctx, span := startSpan(ctx, "InsertDeployments", adapter, repository)
+	defer span.End()
+
+	stored := overwritten(deployments, func(ids []string) ([]internal.Deployment, error) {
+		return listDeployments(ctx, adapter, client, repository, ids, false)
+	})
+
 	var insertValues [][]any
 	var updateValues [][]any
 
@@ -124,410 +205,674 @@ func InsertDeployments(adapter internal.Adapter, repository internal.Repository,
 			environmentId = &deployment.Environment.Id
 		}
 
-		insertValues = append(insertValues, []any{adapter.Name, repository.Id, deployment.Id})
-		updateValues = append(updateValues, []any{deployment.Sha, commitId, deployment.Ref, deployment.Task, environmentId, deployment.CreatedAt, deployment.UpdatedAt, adapter.Name, repository.Id, deployment.Id})
+		rowTtl, keep := ttl(client, storage.TableDeployments, deployment.CreatedAt)
+		if !keep {
+			continue
+		}
+		insertValues = append(insertValues, []any{adapter.Name, repository.Id, deployment.Id, rowTtl})
+		updateValues = append(updateValues, []any{rowTtl, deployment.Sha, commitId, deployment.Ref, deployment.Task, environmentId, deployment.CreatedAt, deployment.UpdatedAt, adapter.Name, repository.Id, deployment.Id})
 	}
 
-	UpsertBatch(client,
-		"INSERT INTO base_data.deployments (adapter, repository_id, id) VALUES (?,?,?)",
+	failures := UpsertBatch(ctx, client,
+		"INSERT INTO base_data.deployments (adapter, repository_id, id) VALUES (?,?,?) USING TTL ?",
 		insertValues,
-		"UPDATE base_data.deployments SET sha = ?, commit_id = ?, ref = ?, task = ?, environment_id = ?, created_at = ?, updated_at = ?, manually_corrected = false WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
+		"UPDATE base_data.deployments USING TTL ? SET sha = ?, commit_id = ?, ref = ?, task = ?, environment_id = ?, created_at = ?, updated_at = ?, manually_corrected = false, deleted_at = null WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
 		updateValues)
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityDeployments, stored, deployments), failures
 }
 
-func InsertEnvironments(adapter internal.Adapter, repository internal.Repository, environments []internal.Environment, client *DatabaseClient) {
+func InsertEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, environments []internal.Environment, client *DatabaseClient) ([]internal.Change, []storage.RowError) {
+	ctx, span := startSpan(ctx, "InsertEnvironments", adapter, repository)
+	defer span.End()
+
+	stored := overwritten(environments, func(ids []string) ([]internal.Environment, error) {
+		return listEnvironments(ctx, adapter, client, repository, ids, false)
+	})
+
 	var insertValues [][]any
 	var updateValues [][]any
 
 	for _, environment := range environments {
-		insertValues = append(insertValues, []any{adapter.Name, repository.Id, environment.Id})
-		updateValues = append(updateValues, []any{environment.Name, environment.CreatedAt, environment.UpdatedAt, adapter.Name, repository.Id, environment.Id})
+		rowTtl, keep := ttl(client, storage.TableEnvironments, environment.CreatedAt)
+		if !keep {
+			continue
+		}
+		insertValues = append(insertValues, []any{adapter.Name, repository.Id, environment.Id, rowTtl})
+		updateValues = append(updateValues, []any{rowTtl, environment.Name, environment.CreatedAt, environment.UpdatedAt, adapter.Name, repository.Id, environment.Id})
 	}
 
-	UpsertBatch(client,
-		"INSERT INTO base_data.environments (adapter, repository_id, id) VALUES (?,?,?)",
+	failures := UpsertBatch(ctx, client,
+		"INSERT INTO base_data.environments (adapter, repository_id, id) VALUES (?,?,?) USING TTL ?",
 		insertValues,
-		"UPDATE base_data.environments SET name = ?, created_at = ?, updated_at = ?, manually_corrected = false WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
+		"UPDATE base_data.environments USING TTL ? SET name = ?, created_at = ?, updated_at = ?, manually_corrected = false, deleted_at = null WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true",
 		updateValues)
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityEnvironments, stored, environments), failures
 }
 
-func InsertDeploymentFrequency(adapter internal.Adapter, repository internal.Repository, frequencies map[string]int, client *DatabaseClient) {
+func InsertDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository, frequencies map[string]int, client *DatabaseClient) []storage.RowError {
+	ctx, span := startSpan(ctx, "InsertDeploymentFrequency", adapter, repository)
+	defer span.End()
+
 	var values [][]any
 
 	for date, frequency := range frequencies {
 		timestamp, _ := time.Parse(time.DateOnly, date)
-		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.Id, repository.FullName, timestamp, frequency})
+		rowTtl, keep := ttl(client, storage.TableDeploymentFrequencies, timestamp)
+		if !keep {
+			continue
+		}
+
+		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.Id, repository.FullName, timestamp, frequency, rowTtl})
 	}
 
-	InsertBatch(client, "INSERT INTO metrics.deployment_frequencies (adapter, grouping_key, repository_id, repository_name, date, frequency) VALUES (?,?,?,?,?,?)", values)
+	failures := InsertBatch(ctx, client, "INSERT INTO metrics.deployment_frequencies (adapter, grouping_key, repository_id, repository_name, date, frequency) VALUES (?,?,?,?,?,?) USING TTL ?", values)
+
+	return append(failures, deleteVanishedDates(ctx, adapter, repository, frequencies, client)...)
 }
 
-func InsertLeadTimeForChange(adapter internal.Adapter, repository internal.Repository, leadTimes map[string]time.Duration, client *DatabaseClient) {
+func InsertLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository, leadTimes map[string]internal.IssueDuration, client *DatabaseClient) []storage.RowError {
+	ctx, span := startSpan(ctx, "InsertLeadTimeForChange", adapter, repository)
+	defer span.End()
+
 	var values [][]any
 
-	for issueId, leadTime := range leadTimes {
+	for issueId, duration := range leadTimes {
+		rowTtl, keep := ttl(client, storage.TableLeadTimes, duration.CreatedAt)
+		if !keep {
+			continue
+		}
+
 		var milliseconds any
-		if leadTime.Milliseconds() < 0 {
-			milliseconds = nil
-		} else {
-			milliseconds = leadTime.Milliseconds()
+		if duration.Duration.Milliseconds() >= 0 {
+			milliseconds = duration.Duration.Milliseconds()
 		}
 
-		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.FullName, issueId, leadTime, milliseconds})
+		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.FullName, issueId, duration.Duration, milliseconds, duration.CreatedAt, repository.Id, rowTtl})
 	}
 
-	InsertBatch(client, "INSERT INTO metrics.lead_times (adapter, repository_id, repository_name, issue_id, lead_time, lead_time_milliseconds) VALUES (?,?,?,?,?,?)", values)
+	failures := InsertBatch(ctx, client, "INSERT INTO metrics.lead_times (adapter, repository_id, repository_name, issue_id, lead_time, lead_time_milliseconds, issue_created_at, issue_repository_id) VALUES (?,?,?,?,?,?,?,?) USING TTL ?", values)
+
+	return append(failures, deleteVanishedIssues(ctx, "metrics.lead_times", adapter, repository, leadTimes, client)...)
 }
 
-func InsertChangeFailureRate(adapter internal.Adapter, repository internal.Repository, changeFailureRate float64, client *DatabaseClient) {
+func InsertChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository, changeFailureRate float64, client *DatabaseClient) []storage.RowError {
+	ctx, span := startSpan(ctx, "InsertChangeFailureRate", adapter, repository)
+	defer span.End()
+
 	var insertValues []any
 	insertValues = append(insertValues, adapter.Name, repository.GroupingKey, repository.FullName, changeFailureRate)
 
 	var updateValues []any
 	updateValues = append(updateValues, changeFailureRate, adapter.Name, repository.GroupingKey)
 
-	Upsert(client,
+	return Upsert(ctx, client,
 		"INSERT INTO metrics.change_failure_rates (adapter, repository_id, repository_name, rate) VALUES (?,?,?,?)",
 		insertValues,
 		"UPDATE metrics.change_failure_rates SET rate = ? WHERE adapter = ? AND repository_id = ?",
 		updateValues)
 }
 
-func InsertTimesToRestoreService(adapter internal.Adapter, repository internal.Repository, timesToRestoreService map[string]time.Duration, client *DatabaseClient) {
+func InsertTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository, timesToRestoreService map[string]internal.IssueDuration, client *DatabaseClient) []storage.RowError {
+	ctx, span := startSpan(ctx, "InsertTimesToRestoreService", adapter, repository)
+	defer span.End()
+
 	var values [][]any
 
-	for issueId, leadTime := range timesToRestoreService {
+	for issueId, duration := range timesToRestoreService {
+		rowTtl, keep := ttl(client, storage.TableTimesToRestoreService, duration.CreatedAt)
+		if !keep {
+			continue
+		}
+
 		var milliseconds any
-		if leadTime.Milliseconds() < 0 {
-			milliseconds = nil
-		} else {
-			milliseconds = leadTime.Milliseconds()
+		if duration.Duration.Milliseconds() >= 0 {
+			milliseconds = duration.Duration.Milliseconds()
 		}
 
-		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.FullName, issueId, leadTime, milliseconds})
+		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.FullName, issueId, duration.Duration, milliseconds, duration.CreatedAt, repository.Id, rowTtl})
 	}
 
-	InsertBatch(client, "INSERT INTO metrics.times_to_restore_service (adapter, repository_id, repository_name, issue_id, time_to_restore_service, time_to_restore_service_milliseconds) VALUES (?,?,?,?,?,?)", values)
+	failures := InsertBatch(ctx, client, "INSERT INTO metrics.times_to_restore_service (adapter, repository_id, repository_name, issue_id, time_to_restore_service, time_to_restore_service_milliseconds, issue_created_at, issue_repository_id) VALUES (?,?,?,?,?,?,?,?) USING TTL ?", values)
+
+	return append(failures, deleteVanishedIssues(ctx, "metrics.times_to_restore_service", adapter, repository, timesToRestoreService, client)...)
 }
 
-func ListRepositories(adapter internal.Adapter, client *DatabaseClient) (repos []internal.Repository) {
-	var values []any
-	values = append(values, adapter.Name)
+// deleteVanishedDates deletes the deployment frequencies of the repository on
+// dates it no longer has, after deployments were deleted. If they can't be
+// read, nothing is deleted and the read is returned as a failed row.
+func deleteVanishedDates(ctx context.Context, adapter internal.Adapter, repository internal.Repository, frequencies map[string]int, client *DatabaseClient) []storage.RowError {
+	statement := "SELECT date FROM metrics.deployment_frequencies WHERE adapter = ? AND grouping_key = ? AND repository_id = ?"
+	args := []any{adapter.Name, repository.GroupingKey, repository.Id}
 
-	results := List(client, "SELECT id, full_name, default_branch, grouping_key, created_at, updated_at FROM base_data.repositories WHERE adapter = ? ALLOW FILTERING", values)
-	for _, result := range results {
-		repos = append(repos, internal.Repository{
-			Id:            result["id"].(string),
-			FullName:      result["full_name"].(string),
-			DefaultBranch: result["default_branch"].(string),
-			CreatedAt:     result["created_at"].(time.Time),
-			UpdatedAt:     result["updated_at"].(time.Time),
-			GroupingKey:   result["grouping_key"].(string),
-		})
+	var values [][]any
+	err := scanRows(ctx, client, statement, args, func(scanner gocql.Scanner) error {
+		var date time.Time
+		if err := scanner.Scan(&date); err != nil {
+			return err
+		}
+
+		if _, ok := frequencies[date.UTC().Format(time.DateOnly)]; !ok {
+			values = append(values, []any{adapter.Name, repository.GroupingKey, repository.Id, date})
+		}
+		return nil
+	})
+	if err != nil {
+		return readFailure(ctx, client, statement, args, err)
 	}
 
-	return
+	return UpdateBatch(ctx, client, "DELETE FROM metrics.deployment_frequencies WHERE adapter = ? AND grouping_key = ? AND repository_id = ? AND date = ?", values)
+}
+
+// deleteVanishedIssues deletes the metrics of the issues of the repository that
+// are missing from durations, because the issues were deleted or no longer
+// count. The partition is shared by all repositories of the grouping key, rows
+// written before the repository of the issue was recorded are matched by name.
+// Like deleteVanishedDates, it returns a failed read as a failed row.
+func deleteVanishedIssues(ctx context.Context, table string, adapter internal.Adapter, repository internal.Repository, durations map[string]internal.IssueDuration, client *DatabaseClient) []storage.RowError {
+	statement := "SELECT issue_id, issue_repository_id, repository_name FROM " + table + " WHERE adapter = ? AND repository_id = ?"
+	args := []any{adapter.Name, repository.GroupingKey}
+
+	var values [][]any
+	err := scanRows(ctx, client, statement, args, func(scanner gocql.Scanner) error {
+		var issueId string
+		var issueRepositoryId, repositoryName *string
+		if err := scanner.Scan(&issueId, &issueRepositoryId, &repositoryName); err != nil {
+			return err
+		}
+
+		ownRow := value(repositoryName) == repository.FullName
+		if issueRepositoryId != nil {
+			ownRow = *issueRepositoryId == repository.Id
+		}
+		if _, ok := durations[issueId]; ok || !ownRow {
+			return nil
+		}
+
+		values = append(values, []any{adapter.Name, repository.GroupingKey, issueId})
+		return nil
+	})
+	if err != nil {
+		return readFailure(ctx, client, statement, args, err)
+	}
+
+	return UpdateBatch(ctx, client, "DELETE FROM "+table+" WHERE adapter = ? AND repository_id = ? AND issue_id = ?", values)
+}
+
+func ListIssues(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) ([]internal.Issue, error) {
+	return listIssues(ctx, adapter, client, repo, nil, true)
 }
 
-func ListIssues(adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (issues []internal.Issue) {
-	var values []any
-	values = append(values, adapter.Name)
-	values = append(values, repo.Id)
+// listIssues reads the issues of the repository that aren't deleted, or only
+// those with ids if ids isn't nil. Manually corrected rows are left out unless
+// corrected is true.
+func listIssues(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository, ids []string, corrected bool) (issues []internal.Issue, err error) {
+	filter, values := "", []any{adapter.Name, repo.Id}
+	if ids != nil {
+		filter, values = " AND id IN ?", append(values, ids)
+	}
 
-	results := List(client, "SELECT id, pull_request_ids, created_at, closed_at, type FROM base_data.issues WHERE adapter = ? AND repository_id = ?", values)
-	for _, result := range results {
-		closedAt := result["closed_at"].(time.Time)
-		issueType := result["type"].(string)
+	err = scanRows(ctx, client, "SELECT id, pull_request_ids, created_at, closed_at, type, deleted_at, manually_corrected FROM base_data.issues WHERE adapter = ? AND repository_id = ?"+filter, values, func(scanner gocql.Scanner) error {
+		var row issueRow
+		if err := scanner.Scan(&row.Id, &row.PullRequestIds, &row.CreatedAt, &row.ClosedAt, &row.Type, &row.DeletedAt, &row.ManuallyCorrected); err != nil {
+			return err
+		}
+		if row.DeletedAt != nil || !corrected && value(row.ManuallyCorrected) {
+			return nil
+		}
 
 		issues = append(issues, internal.Issue{
 			WorkItem: internal.WorkItem{
-				ID:        result["id"].(string),
-				CreatedAt: result["created_at"].(time.Time),
-				ClosedAt:  &closedAt,
+				ID:        row.Id,
+				CreatedAt: value(row.CreatedAt),
+				ClosedAt:  row.ClosedAt,
 				Repo:      &repo,
 			},
-			PullRequests: result["pull_request_ids"].([]string),
-			Type:         &issueType,
+			PullRequests: row.PullRequestIds,
+			Type:         row.Type,
 		})
-	}
+		return nil
+	})
 
 	return
 }
 
-func ListCommits(adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (commits []internal.Commit) {
-	var values []any
-	values = append(values, adapter.Name)
-	values = append(values, repo.Id)
+func ListCommits(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (commits []internal.Commit, err error) {
+	err = scanRows(ctx, client, "SELECT id, created_at FROM base_data.commits WHERE adapter = ? AND repository_id = ?", []any{adapter.Name, repo.Id}, func(scanner gocql.Scanner) error {
+		var row commitRow
+		if err := scanner.Scan(&row.Id, &row.CreatedAt); err != nil {
+			return err
+		}
 
-	results := List(client, "SELECT id, created_at FROM base_data.commits WHERE adapter = ? AND repository_id = ?", values)
-	for _, result := range results {
 		commits = append(commits, internal.Commit{
-			Sha:       result["id"].(string),
+			Sha:       row.Id,
 			Repo:      &repo,
-			CreatedAt: result["created_at"].(time.Time),
+			CreatedAt: value(row.CreatedAt),
 		})
-	}
+		return nil
+	})
 
 	return
 }
 
-func ListPullRequests(adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (pullRequests []internal.PullRequest) {
-	var values []any
-	values = append(values, adapter.Name)
-	values = append(values, repo.Id)
-
-	results := List(client, "SELECT id, base, head, issue_ids, merged_at, closed_at, created_at, commit_ids FROM base_data.pull_requests WHERE adapter = ? AND repository_id = ?", values)
-	for _, result := range results {
-		closedAt := result["closed_at"].(time.Time)
-		mergedAt := result["merged_at"].(time.Time)
+func ListPullRequests(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) ([]internal.PullRequest, error) {
+	return listPullRequests(ctx, adapter, client, repo, nil, true)
+}
 
-		var head internal.Head
-		var base internal.Head
+// listPullRequests reads the pull requests of the repository that aren't deleted, or only
+// those with ids if ids isn't nil. Manually corrected rows are left out unless
+// corrected is true.
+func listPullRequests(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository, ids []string, corrected bool) (pullRequests []internal.PullRequest, err error) {
+	filter, values := "", []any{adapter.Name, repo.Id}
+	if ids != nil {
+		filter, values = " AND id IN ?", append(values, ids)
+	}
 
-		if result["head"] != nil {
-			headMap := result["head"].(map[string]interface{})
-			head = internal.Head{
-				Ref: headMap["ref"].(string),
-				Sha: headMap["id"].(string),
-			}
+	err = scanRows(ctx, client, "SELECT id, base, head, issue_ids, merged_at, closed_at, created_at, commit_ids, deleted_at, manually_corrected FROM base_data.pull_requests WHERE adapter = ? AND repository_id = ?"+filter, values, func(scanner gocql.Scanner) error {
+		var row pullRequestRow
+		if err := scanner.Scan(&row.Id, &row.Base, &row.Head, &row.IssueIds, &row.MergedAt, &row.ClosedAt, &row.CreatedAt, &row.CommitIds, &row.DeletedAt, &row.ManuallyCorrected); err != nil {
+			return err
 		}
-		if result["base"] != nil {
-			headMap := result["base"].(map[string]interface{})
-			base = internal.Head{
-				Ref: headMap["ref"].(string),
-				Sha: headMap["id"].(string),
-			}
+		if row.DeletedAt != nil || !corrected && value(row.ManuallyCorrected) {
+			return nil
 		}
 
 		var issues []internal.Issue
 		var commits []internal.Commit
 
-		for _, issueId := range result["issue_ids"].([]string) {
+		for _, issueId := range row.IssueIds {
 			issues = append(issues, internal.Issue{
 				WorkItem: internal.WorkItem{
-					ID:        issueId,
-					CreatedAt: time.Time{},
-					ClosedAt:  nil,
-					Repo:      &repo,
+					ID:   issueId,
+					Repo: &repo,
 				},
-				PullRequests: nil,
-				Type:         nil,
 			})
 		}
-		for _, commitId := range result["commit_ids"].([]string) {
+		for _, commitId := range row.CommitIds {
 			commits = append(commits, internal.Commit{
-				Sha:       commitId,
-				Repo:      &repo,
-				CreatedAt: time.Time{},
+				Sha:  commitId,
+				Repo: &repo,
 			})
 		}
 
 		pullRequests = append(pullRequests, internal.PullRequest{
 			WorkItem: internal.WorkItem{
-				ID:        result["id"].(string),
-				CreatedAt: result["created_at"].(time.Time),
-				ClosedAt:  &closedAt,
+				ID:        row.Id,
+				CreatedAt: value(row.CreatedAt),
+				ClosedAt:  row.ClosedAt,
 				Repo:      &repo,
 			},
-			Head:     &head,
-			Base:     &base,
-			MergedAt: &mergedAt,
+			Head:     row.Head.head(),
+			Base:     row.Base.head(),
+			MergedAt: row.MergedAt,
 			Issues:   issues,
 			Commits:  commits,
 		})
-	}
+		return nil
+	})
 
 	return
 }
 
-func ListDeployments(adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (deployments []internal.Deployment) {
-	var values []any
-	values = append(values, adapter.Name)
-	values = append(values, repo.Id)
+func ListDeployments(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) ([]internal.Deployment, error) {
+	return listDeployments(ctx, adapter, client, repo, nil, true)
+}
 
-	results := List(client, "SELECT id, ref, task, environment_id, commit_id, sha, created_at, updated_at FROM base_data.deployments WHERE adapter = ? AND repository_id = ?", values)
-	for _, result := range results {
-		deployments = append(deployments, internal.Deployment{
-			Id:  result["id"].(string),
-			Sha: result["sha"].(string),
-			Commit: &internal.Commit{
-				Sha:       result["commit_id"].(string),
-				Repo:      &repo,
-				CreatedAt: time.Time{},
-			},
-			Ref:  result["ref"].(string),
-			Task: result["task"].(string),
-			Environment: &internal.Environment{
-				Id:        result["environment_id"].(string),
-				Name:      result["environment_id"].(string),
-				CreatedAt: time.Time{},
-				UpdatedAt: time.Time{},
-			},
-			CreatedAt: result["created_at"].(time.Time),
-			UpdatedAt: result["updated_at"].(time.Time),
-		})
+// listDeployments reads the deployments of the repository that aren't deleted, or only
+// those with ids if ids isn't nil. Manually corrected rows are left out unless
+// corrected is true.
+func listDeployments(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository, ids []string, corrected bool) (deployments []internal.Deployment, err error) {
+	filter, values := "", []any{adapter.Name, repo.Id}
+	if ids != nil {
+		filter, values = " AND id IN ?", append(values, ids)
 	}
 
+	err = scanRows(ctx, client, "SELECT id, ref, task, environment_id, commit_id, sha, created_at, updated_at, deleted_at, manually_corrected FROM base_data.deployments WHERE adapter = ? AND repository_id = ?"+filter, values, func(scanner gocql.Scanner) error {
+		var row deploymentRow
+		if err := scanner.Scan(&row.Id, &row.Ref, &row.Task, &row.EnvironmentId, &row.CommitId, &row.Sha, &row.CreatedAt, &row.UpdatedAt, &row.DeletedAt, &row.ManuallyCorrected); err != nil {
+			return err
+		}
+		if row.DeletedAt != nil || !corrected && value(row.ManuallyCorrected) {
+			return nil
+		}
+
+		deployment := internal.Deployment{
+			Id:        row.Id,
+			Sha:       value(row.Sha),
+			Ref:       value(row.Ref),
+			Task:      value(row.Task),
+			CreatedAt: value(row.CreatedAt),
+			UpdatedAt: value(row.UpdatedAt),
+		}
+		if row.CommitId != nil {
+			deployment.Commit = &internal.Commit{Sha: *row.CommitId, Repo: &repo}
+		}
+		if row.EnvironmentId != nil {
+			deployment.Environment = &internal.Environment{Id: *row.EnvironmentId, Name: *row.EnvironmentId}
+		}
+
+		deployments = append(deployments, deployment)
+		return nil
+	})
+
 	return
 }
 
-func ListEnvironments(adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (environments []internal.Environment) {
-	var values []any
-	values = append(values, adapter.Name)
-	values = append(values, repo.Id)
+func ListEnvironments(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) ([]internal.Environment, error) {
+	return listEnvironments(ctx, adapter, client, repo, nil, true)
+}
+
+// listEnvironments reads the environments of the repository that aren't deleted, or only
+// those with ids if ids isn't nil. Manually corrected rows are left out unless
+// corrected is true.
+func listEnvironments(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository, ids []string, corrected bool) (environments []internal.Environment, err error) {
+	filter, values := "", []any{adapter.Name, repo.Id}
+	if ids != nil {
+		filter, values = " AND id IN ?", append(values, ids)
+	}
+
+	err = scanRows(ctx, client, "SELECT id, name, created_at, updated_at, deleted_at, manually_corrected FROM base_data.environments WHERE adapter = ? AND repository_id = ?"+filter, values, func(scanner gocql.Scanner) error {
+		var row environmentRow
+		if err := scanner.Scan(&row.Id, &row.Name, &row.CreatedAt, &row.UpdatedAt, &row.DeletedAt, &row.ManuallyCorrected); err != nil {
+			return err
+		}
+		if row.DeletedAt != nil || !corrected && value(row.ManuallyCorrected) {
+			return nil
+		}
 
-	results := List(client, "SELECT id, name, created_at, updated_at FROM base_data.commits WHERE adapter = ? AND repository_id = ?", values)
-	for _, result := range results {
 		environments = append(environments, internal.Environment{
-			Id:        result["id"].(string),
-			Name:      result["name"].(string),
-			CreatedAt: result["created_at"].(time.Time),
-			UpdatedAt: result["updated_at"].(time.Time),
+			Id:        row.Id,
+			Name:      value(row.Name),
+			CreatedAt: value(row.CreatedAt),
+			UpdatedAt: value(row.UpdatedAt),
 		})
-	}
+		return nil
+	})
 
 	return
 }
 
-func List(client *DatabaseClient, statement string, values []any) (results []map[string]interface{}) {
-	Connect(client)
+func ListDeploymentFrequency(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (frequencies map[string]int, err error) {
+	frequencies = make(map[string]int)
 
-	if client.session != nil {
-		query := client.session.Query(statement, values...)
-		iter := query.Iter()
-		for {
-			result := make(map[string]interface{})
-			if !iter.MapScan(result) {
-				break
-			}
+	err = scanRows(ctx, client, "SELECT date, frequency FROM metrics.deployment_frequencies WHERE adapter = ? AND grouping_key = ? AND repository_id = ?", []any{adapter.Name, repo.GroupingKey, repo.Id}, func(scanner gocql.Scanner) error {
+		var date time.Time
+		var frequency *int
+		if err := scanner.Scan(&date, &frequency); err != nil {
+			return err
+		}
+
+		frequencies[date.UTC().Format(time.DateOnly)] = value(frequency)
+		return nil
+	})
+
+	return
+}
+
+func ListLeadTimeForChange(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (leadTimes map[string]time.Duration, err error) {
+	leadTimes = make(map[string]time.Duration)
 
-			results = append(results, result)
+	err = scanRows(ctx, client, "SELECT issue_id, lead_time FROM metrics.lead_times WHERE adapter = ? AND repository_id = ?", []any{adapter.Name, repo.GroupingKey}, func(scanner gocql.Scanner) error {
+		var issueId string
+		var leadTime gocql.Duration
+		if err := scanner.Scan(&issueId, &leadTime); err != nil {
+			return err
 		}
-	}
 
-	return results
+		leadTimes[issueId] = toDuration(leadTime)
+		return nil
+	})
+
+	return
 }
 
-func InsertBatch(client *DatabaseClient, statement string, values [][]any) {
-	Connect(client)
+func ListChangeFailureRate(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (changeFailureRate float64, err error) {
+	err = scanRows(ctx, client, "SELECT rate FROM metrics.change_failure_rates WHERE adapter = ? AND repository_id = ?", []any{adapter.Name, repo.GroupingKey}, func(scanner gocql.Scanner) error {
+		var rate *float64
+		if err := scanner.Scan(&rate); err != nil {
+			return err
+		}
 
-	if client.session != nil {
-		var chunks [][][]any
+		changeFailureRate = value(rate)
+		return nil
+	})
 
-		for i := 0; i < len(values); i += chunkSize {
-			end := i + chunkSize
+	return
+}
 
-			if end > len(values) {
-				end = len(values)
-			}
+func ListTimesToRestoreService(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository) (timesToRestoreService map[string]time.Duration, err error) {
+	timesToRestoreService = make(map[string]time.Duration)
 
-			chunks = append(chunks, values[i:end])
+	err = scanRows(ctx, client, "SELECT issue_id, time_to_restore_service FROM metrics.times_to_restore_service WHERE adapter = ? AND repository_id = ?", []any{adapter.Name, repo.GroupingKey}, func(scanner gocql.Scanner) error {
+		var issueId string
+		var timeToRestoreService gocql.Duration
+		if err := scanner.Scan(&issueId, &timeToRestoreService); err != nil {
+			return err
 		}
 
-		for _, chunk := range chunks {
-			batch := client.session.NewBatch(gocql.UnloggedBatch)
+		timesToRestoreService[issueId] = toDuration(timeToRestoreService)
+		return nil
+	})
 
-			for _, args := range chunk {
-				batch.Entries = append(batch.Entries, gocql.BatchEntry{
-					Stmt:       statement,
-					Args:       args,
-					Idempotent: true,
-				})
-			}
+	return
+}
 
-			if len(batch.Entries) > 0 {
-				err := client.session.ExecuteBatch(batch)
-				if err != nil {
-					internal.ProcessError(err)
-					return
-				}
-			}
+// overwritten reads the stored rows that an upsert of items overwrites, in
+// chunks of lookupChunkSize ids. list leaves out manually corrected and deleted
+// rows, which are kept or count as new. The rows are written regardless, so the
+// changes of a chunk that can't be read are logged and skipped.
+func overwritten[T any](items []T, list func(ids []string) ([]T, error)) (stored []T) {
+	for i := 0; i < len(items); i += lookupChunkSize {
+		var ids []string
+		for _, item := range items[i:min(i+lookupChunkSize, len(items))] {
+			ids = append(ids, history.Id(item))
 		}
+
+		rows, err := list(ids)
+		if err != nil {
+			slog.Warn("Could not read the stored rows, their changes aren't recorded", "rows", len(ids), internal.ErrorAttr(err))
+			continue
+		}
+		stored = append(stored, rows...)
 	}
+
+	return
 }
 
-func UpsertBatch(client *DatabaseClient, insertStatement string, insertValues [][]any, updateStatement string, updateValues [][]any) {
-	Connect(client)
+// ListIds returns the ids of the stored items of entity that aren't deleted.
+func ListIds(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repo internal.Repository, entity string) (ids []string, err error) {
+	switch entity {
+	case storage.EntityIssues, storage.EntityPullRequests, storage.EntityDeployments, storage.EntityEnvironments:
+	default:
+		return nil, fmt.Errorf("unknown entity %q", entity)
+	}
 
-	if client.session != nil {
-		var insertChunks [][][]any
-		var updateChunks [][][]any
+	err = scanRows(ctx, client, "SELECT id, deleted_at FROM base_data."+entity+" WHERE adapter = ? AND repository_id = ?", []any{adapter.Name, repo.Id}, func(scanner gocql.Scanner) error {
+		var id string
+		var deletedAt *time.Time
+		if err := scanner.Scan(&id, &deletedAt); err != nil {
+			return err
+		}
+
+		if deletedAt == nil {
+			ids = append(ids, id)
+		}
+		return nil
+	})
 
-		for i := 0; i < len(insertValues); i += chunkSize / 2 {
-			end := i + chunkSize/2
+	return
+}
 
-			if end > len(insertValues) {
-				end = len(insertValues)
-			}
+// GetItem reads one item that isn't deleted, or returns nil if there is none.
+func GetItem(ctx context.Context, adapter internal.Adapter, client *DatabaseClient, repositoryId string, entity string, id string) (any, error) {
+	repo := internal.Repository{Id: repositoryId}
+	ids := []string{id}
 
-			insertChunks = append(insertChunks, insertValues[i:end])
+	switch entity {
+	case storage.EntityRepositories:
+		stored, _, err := storedRepository(ctx, client, adapter.Name, id)
+		if stored == nil {
+			return nil, err
 		}
+		return *stored, err
+	case storage.EntityIssues:
+		return first(listIssues(ctx, adapter, client, repo, ids, true))
+	case storage.EntityPullRequests:
+		return first(listPullRequests(ctx, adapter, client, repo, ids, true))
+	case storage.EntityDeployments:
+		return first(listDeployments(ctx, adapter, client, repo, ids, true))
+	case storage.EntityEnvironments:
+		return first(listEnvironments(ctx, adapter, client, repo, ids, true))
+	}
 
-		for i := 0; i < len(updateValues); i += chunkSize / 2 {
-			end := i + chunkSize/2
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
 
-			if end > len(updateValues) {
-				end = len(updateValues)
-			}
+// first returns the item of a read by id, or nil if there is none.
+func first[T any](items []T, err error) (any, error) {
+	if len(items) == 0 {
+		return nil, err
+	}
 
-			updateChunks = append(updateChunks, updateValues[i:end])
-		}
+	return items[0], err
+}
 
-		for index, _ := range insertChunks {
-			batch := client.session.NewBatch(gocql.UnloggedBatch)
+// MarkDeleted tombstones the items, unless they were manually corrected.
+func MarkDeleted(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string, ids []string, deletedAt time.Time, client *DatabaseClient) []storage.RowError {
+	ctx, span := startSpan(ctx, "MarkDeleted", adapter, repository)
+	defer span.End()
 
-			insertChunk := insertChunks[index]
-			for _, args := range insertChunk {
-				batch.Entries = append(batch.Entries, gocql.BatchEntry{
-					Stmt:       insertStatement,
-					Args:       args,
-					Idempotent: true,
-				})
-			}
+	statement := "UPDATE base_data." + entity + " SET deleted_at = ? WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true"
 
-			updateChunk := updateChunks[index]
-			for _, args := range updateChunk {
-				batch.Entries = append(batch.Entries, gocql.BatchEntry{
-					Stmt:       updateStatement,
-					Args:       args,
-					Idempotent: true,
-				})
-			}
+	var values [][]any
+	for _, id := range ids {
+		values = append(values, []any{deletedAt, adapter.Name, repository.Id, id})
+	}
 
-			if len(batch.Entries) > 0 {
-				err := client.session.ExecuteBatch(batch)
-				if err != nil {
-					internal.ProcessError(err)
-					return
-				}
-			}
+	switch entity {
+	case storage.EntityIssues, storage.EntityPullRequests, storage.EntityDeployments, storage.EntityEnvironments:
+	default:
+		var failures []storage.RowError
+		for _, args := range values {
+			failures = append(failures, storage.RowError{Statement: qualify(client, statement), Args: args, Err: fmt.Errorf("unknown entity %q", entity)})
 		}
+		return reportFailures(span, failures)
 	}
+
+	return UpdateBatch(ctx, client, statement, values)
+}
+
+func toDuration(duration gocql.Duration) time.Duration {
+	return time.Duration(duration.Days)*24*time.Hour + time.Duration(duration.Nanoseconds)
 }
 
-func Upsert(client *DatabaseClient, insertStatement string, insertValues []any, updateStatement string, updateValues []any) {
+func InsertBatch(ctx context.Context, client *DatabaseClient, statement string, values [][]any) []storage.RowError {
+	statement = qualify(client, statement)
+	ctx, span := startStatementSpan(ctx, "InsertBatch", statement, len(values))
+	defer span.End()
+
+	if IsDryRun(client) {
+		record(ctx, client, statement, values)
+		return nil
+	}
+
 	Connect(client)
 
-	if client.session != nil {
-		batch := client.session.NewBatch(gocql.LoggedBatch)
+	if client.session == nil {
+		return nil
+	}
 
-		batch.Entries = append(batch.Entries, gocql.BatchEntry{
-			Stmt:       insertStatement,
-			Args:       insertValues,
-			Idempotent: true,
-		})
+	return reportFailures(span, executeWrites(ctx, client, batchesByPartition(statement, values)))
+}
 
-		batch.Entries = append(batch.Entries, gocql.BatchEntry{
-			Stmt:       updateStatement,
-			Args:       updateValues,
-			Idempotent: true,
-		})
+// UpsertBatch first creates the rows that don't exist yet and then updates all
+// of them. The conditional updates are sent one by one, but concurrently.
+func UpsertBatch(ctx context.Context, client *DatabaseClient, insertStatement string, insertValues [][]any, updateStatement string, updateValues [][]any) []storage.RowError {
+	insertStatement = qualify(client, insertStatement)
+	updateStatement = qualify(client, updateStatement)
+	ctx, span := startStatementSpan(ctx, "UpsertBatch", updateStatement, len(updateValues))
+	defer span.End()
+
+	if IsDryRun(client) {
+		record(ctx, client, insertStatement, insertValues)
+		record(ctx, client, updateStatement, updateValues)
+		return nil
+	}
 
-		err := client.session.ExecuteBatch(batch)
-		if err != nil {
-			internal.ProcessError(err)
-		}
+	Connect(client)
+
+	if client.session == nil {
+		return nil
+	}
+
+	failures := executeWrites(ctx, client, batchesByPartition(insertStatement, insertValues))
+	failures = append(failures, executeWrites(ctx, client, updates(updateStatement, updateValues))...)
+
+	return reportFailures(span, failures)
+}
+
+// UpdateBatch updates existing rows, see UpsertBatch.
+func UpdateBatch(ctx context.Context, client *DatabaseClient, statement string, values [][]any) []storage.RowError {
+	statement = qualify(client, statement)
+	ctx, span := startStatementSpan(ctx, "UpdateBatch", statement, len(values))
+	defer span.End()
+
+	if IsDryRun(client) {
+		record(ctx, client, statement, values)
+		return nil
 	}
+
+	Connect(client)
+
+	if client.session == nil {
+		return nil
+	}
+
+	return reportFailures(span, executeWrites(ctx, client, updates(statement, values)))
+}
+
+func Upsert(ctx context.Context, client *DatabaseClient, insertStatement string, insertValues []any, updateStatement string, updateValues []any) []storage.RowError {
+	return UpsertBatch(ctx, client, insertStatement, [][]any{insertValues}, updateStatement, [][]any{updateValues})
+}
+
+// reportFailures logs every row that could not be written and returns them. The
+// remaining rows are stored regardless, so one bad row doesn't stop a whole
+// repository.
+func reportFailures(span trace.Span, failures []storage.RowError) []storage.RowError {
+	for _, failure := range failures {
+		slog.Error("Could not write row", "statement", failure.Statement, "row", failure.Args, internal.ErrorAttr(failure.Err))
+	}
+
+	if len(failures) > 0 {
+		span.SetAttributes(attribute.Int("db.failed_rows", len(failures)))
+		tracing.RecordError(span, fmt.Errorf("%d rows could not be written", len(failures)))
+	}
+
+	return failures
+}
+
+// readFailure returns a read that a write depends on as a failed row, so the
+// run is partial instead of stopping.
+func readFailure(ctx context.Context, client *DatabaseClient, statement string, args []any, err error) []storage.RowError {
+	return reportFailures(trace.SpanFromContext(ctx), []storage.RowError{{Statement: qualify(client, statement), Args: args, Err: err}})
+}
+
+func startSpan(ctx context.Context, name string, adapter internal.Adapter, repository internal.Repository) (context.Context, trace.Span) {
+	ctx, span := tracing.Start(ctx, name)
+	span.SetAttributes(attribute.String("adapter", adapter.Name), attribute.String("repository", repository.Id))
+
+	return ctx, span
+}
+
+func startStatementSpan(ctx context.Context, name string, statement string, rows int) (context.Context, trace.Span) {
+	ctx, span := tracing.Start(ctx, name)
+	span.SetAttributes(attribute.String("db.system", "cassandra"), attribute.String("db.statement", statement))
+	if rows > 0 {
+		span.SetAttributes(attribute.Int("db.rows", rows))
+	}
+
+	return ctx, span
 }
 
 func Close(client *DatabaseClient) {
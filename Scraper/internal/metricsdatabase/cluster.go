@@ -0,0 +1,105 @@
+package metricsdatabase
+
+import (
+	"fmt"
+	"github.com/gocql/gocql"
+	"strings"
+	"thesis/scraper/internal"
+)
+
+// newCluster translates the configuration into the options of the driver. Unset
+// options keep the defaults of gocql, except for the protocol version, which
+// stays at 3 unless configured.
+func newCluster(config internal.DatabaseConfig) (*gocql.ClusterConfig, error) {
+	cluster := gocql.NewCluster(config.Hosts...)
+	cluster.Authenticator = gocql.PasswordAuthenticator{
+		Username: config.Username,
+		Password: config.Password,
+	}
+
+	cluster.ProtoVersion = 3
+	if config.ProtoVersion != 0 {
+		cluster.ProtoVersion = config.ProtoVersion
+	}
+
+	if config.WriteConsistency != "" {
+		consistency, err := gocql.ParseConsistencyWrapper(config.WriteConsistency)
+		if err != nil {
+			return nil, fmt.Errorf("write consistency: %w", err)
+		}
+		cluster.Consistency = consistency
+	}
+
+	if config.SerialConsistency != "" {
+		err := cluster.SerialConsistency.UnmarshalText([]byte(strings.ToUpper(config.SerialConsistency)))
+		if err != nil {
+			return nil, fmt.Errorf("serial consistency: %w", err)
+		}
+	}
+
+	var hostPolicy gocql.HostSelectionPolicy = gocql.RoundRobinHostPolicy()
+	if config.LocalDatacenter != "" {
+		hostPolicy = gocql.DCAwareRoundRobinPolicy(config.LocalDatacenter)
+	}
+	if config.TokenAware {
+		hostPolicy = gocql.TokenAwareHostPolicy(hostPolicy)
+	}
+	cluster.PoolConfig.HostSelectionPolicy = hostPolicy
+
+	if config.Timeout > 0 {
+		cluster.Timeout = config.Timeout
+	}
+	if config.ConnectTimeout > 0 {
+		cluster.ConnectTimeout = config.ConnectTimeout
+	}
+
+	switch strings.ToLower(config.Compression) {
+	case "", "none":
+	case "snappy":
+		cluster.Compressor = gocql.SnappyCompressor{}
+	default:
+		return nil, fmt.Errorf("unknown compression %q", config.Compression)
+	}
+
+	switch strings.ToLower(config.Retry.Policy) {
+	case "":
+	case "simple":
+		cluster.RetryPolicy = &gocql.SimpleRetryPolicy{NumRetries: config.Retry.Retries}
+	case "exponential":
+		cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{NumRetries: config.Retry.Retries, Min: config.Retry.MinBackoff, Max: config.Retry.MaxBackoff}
+	case "downgrading":
+		// Retries once at the weakest consistency, within the local datacenter if there is one
+		downgraded := gocql.One
+		if config.LocalDatacenter != "" {
+			downgraded = gocql.LocalOne
+		}
+		cluster.RetryPolicy = &gocql.DowngradingConsistencyRetryPolicy{ConsistencyLevelsToTry: []gocql.Consistency{downgraded}}
+	default:
+		return nil, fmt.Errorf("unknown retry policy %q", config.Retry.Policy)
+	}
+
+	if config.Tls.Enabled {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 config.Tls.CaPath,
+			CertPath:               config.Tls.CertPath,
+			KeyPath:                config.Tls.KeyPath,
+			EnableHostVerification: config.Tls.VerifyHost,
+		}
+	}
+
+	return cluster, nil
+}
+
+// readConsistency defaults to the consistency of the writes.
+func readConsistency(config internal.DatabaseConfig, cluster *gocql.ClusterConfig) (gocql.Consistency, error) {
+	if config.ReadConsistency == "" {
+		return cluster.Consistency, nil
+	}
+
+	consistency, err := gocql.ParseConsistencyWrapper(config.ReadConsistency)
+	if err != nil {
+		return 0, fmt.Errorf("read consistency: %w", err)
+	}
+
+	return consistency, nil
+}
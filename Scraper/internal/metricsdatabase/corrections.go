@@ -0,0 +1,100 @@
+package metricsdatabase
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+)
+
+// ApplyCorrection overwrites the fields of an item, marks it as manually
+// corrected and records who corrected it. A corrected grouping key moves the
+// repository out of its previous group. It returns the failed rows as an error.
+func ApplyCorrection(ctx context.Context, correction internal.Correction, values map[string]any, client *DatabaseClient) error {
+	var fields []string
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var assignments []string
+	var args []any
+	for _, field := range fields {
+		assignments = append(assignments, field+" = ?")
+		args = append(args, values[field])
+	}
+
+	condition := "adapter = ? AND repository_id = ? AND id = ?"
+	args = append(args, correction.Adapter, correction.RepositoryId, correction.Id)
+	if correction.Entity == storage.EntityRepositories {
+		condition = "adapter = ? AND id = ?"
+		args = append(args[:len(fields)], correction.Adapter, correction.Id)
+	}
+
+	var previous *internal.Repository
+	if correction.Entity == storage.EntityRepositories {
+		var err error
+		if previous, _, err = storedRepository(ctx, client, correction.Adapter, correction.Id); err != nil {
+			return err
+		}
+	}
+
+	statement := fmt.Sprintf("UPDATE base_data.%s SET %s, manually_corrected = true WHERE %s", correction.Entity, strings.Join(assignments, ", "), condition)
+	if failures := UpdateBatch(ctx, client, statement, [][]any{args}); failures != nil {
+		return storage.Join(failures)
+	}
+
+	var failures []storage.RowError
+	if previous != nil {
+		failures = indexRepository(ctx, client, correction.Adapter, correction.Id, &previous.GroupingKey)
+
+		if groupingKey, ok := values["grouping_key"]; ok && groupingKey != previous.GroupingKey {
+			failures = append(failures, deleteGroupedMetrics(ctx, client, internal.Adapter{Name: correction.Adapter}, *previous)...)
+		}
+	}
+
+	failures = append(failures, InsertBatch(ctx, client, "INSERT INTO base_data.corrections (adapter, repository_id, corrected_at, entity, id, fields, author) VALUES (?,?,?,?,?,?,?)",
+		[][]any{{correction.Adapter, correction.RepositoryId, correction.CorrectedAt, correction.Entity, correction.Id, correction.Fields, correction.Author}})...)
+
+	return storage.Join(failures)
+}
+
+// deleteGroupedMetrics deletes the metrics a repository stored under its
+// previous grouping key, which would otherwise stay in the old group. The next
+// aggregation stores them under the corrected key. The change failure rate is
+// shared by the group, so it is only deleted with the last repository.
+func deleteGroupedMetrics(ctx context.Context, client *DatabaseClient, adapter internal.Adapter, previous internal.Repository) (failures []storage.RowError) {
+	failures = deleteVanishedDates(ctx, adapter, previous, nil, client)
+	failures = append(failures, deleteVanishedIssues(ctx, "metrics.lead_times", adapter, previous, nil, client)...)
+	failures = append(failures, deleteVanishedIssues(ctx, "metrics.times_to_restore_service", adapter, previous, nil, client)...)
+
+	remaining, err := ListRepositoriesByGroupingKey(ctx, adapter, previous.GroupingKey, client)
+	if err != nil {
+		return append(failures, readFailure(ctx, client, "SELECT id FROM base_data.repositories_by_grouping_key WHERE adapter = ? AND grouping_key = ?", []any{adapter.Name, previous.GroupingKey}, err)...)
+	}
+	if len(remaining) == 0 {
+		failures = append(failures, UpdateBatch(ctx, client, "DELETE FROM metrics.change_failure_rates WHERE adapter = ? AND repository_id = ?", [][]any{{adapter.Name, previous.GroupingKey}})...)
+	}
+
+	return
+}
+
+// ListCorrections returns the corrections of a repository, newest first.
+func ListCorrections(ctx context.Context, client *DatabaseClient, adapter string, repositoryId string) (corrections []internal.Correction, err error) {
+	err = scanRows(ctx, client, "SELECT corrected_at, entity, id, fields, author FROM base_data.corrections WHERE adapter = ? AND repository_id = ?", []any{adapter, repositoryId}, func(scanner gocql.Scanner) error {
+		correction := internal.Correction{Adapter: adapter, RepositoryId: repositoryId}
+		var author *string
+		if err := scanner.Scan(&correction.CorrectedAt, &correction.Entity, &correction.Id, &correction.Fields, &author); err != nil {
+			return err
+		}
+
+		correction.Author = value(author)
+		corrections = append(corrections, correction)
+		return nil
+	})
+
+	return
+}
@@ -0,0 +1,150 @@
+package metricsdatabase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"thesis/scraper/internal"
+)
+
+// Recorder collects the writes a client would have executed. A client with a
+// recorder still reads from Cassandra, but never writes to it.
+type Recorder struct {
+	mutex  sync.Mutex
+	tables map[string]*RecordedTable
+}
+
+type RecordedTable struct {
+	Table      string         `json:"table"`
+	Statements []string       `json:"statements"`
+	Rows       int            `json:"rows"`
+	Skipped    []RecordedSkip `json:"skipped,omitempty"`
+	statements map[string]void
+}
+
+// RecordedSkip is a row whose update would not be applied, because the row was
+// manually corrected.
+type RecordedSkip struct {
+	Key []any `json:"key"`
+}
+
+type void struct{}
+
+// updatePattern matches the conditional updates of rows that may have been
+// manually corrected, with or without a TTL.
+var updatePattern = regexp.MustCompile(`(?is)^\s*UPDATE\s+([\w.]+)\s+(?:USING\s+TTL\s+\?\s+)?SET\s+.*\s+WHERE\s+(.*?)\s+IF\s+manually_corrected\s*!=\s*true\s*$`)
+
+func NewRecorder() *Recorder {
+	return &Recorder{tables: make(map[string]*RecordedTable)}
+}
+
+func EnableDryRun(client *DatabaseClient, recorder *Recorder) {
+	client.recorder = recorder
+}
+
+func IsDryRun(client *DatabaseClient) bool {
+	return client.recorder != nil
+}
+
+func record(ctx context.Context, client *DatabaseClient, statement string, values [][]any) {
+	var skipped []RecordedSkip
+	if match := updatePattern.FindStringSubmatch(statement); match != nil {
+		for _, args := range values {
+			key := args[len(args)-strings.Count(match[2], "?"):]
+			if isManuallyCorrected(ctx, client, match[1], match[2], key) {
+				skipped = append(skipped, RecordedSkip{Key: key})
+			}
+		}
+	}
+
+	client.recorder.mutex.Lock()
+	defer client.recorder.mutex.Unlock()
+
+	name := tableOf(statement)
+	table, ok := client.recorder.tables[name]
+	if !ok {
+		table = &RecordedTable{Table: name, statements: make(map[string]void)}
+		client.recorder.tables[name] = table
+	}
+
+	if _, ok := table.statements[statement]; !ok {
+		table.statements[statement] = void{}
+		table.Statements = append(table.Statements, statement)
+	}
+	table.Rows += len(values)
+	table.Skipped = append(table.Skipped, skipped...)
+}
+
+func isManuallyCorrected(ctx context.Context, client *DatabaseClient, table string, where string, key []any) bool {
+	Connect(client)
+
+	if client.session == nil {
+		return false
+	}
+
+	var manuallyCorrected bool
+	err := client.session.Query(fmt.Sprintf("SELECT manually_corrected FROM %s WHERE %s", table, where), key...).Consistency(client.readConsistency).WithContext(ctx).Scan(&manuallyCorrected)
+	if err != nil {
+		// A missing row can't be manually corrected
+		return false
+	}
+
+	return manuallyCorrected
+}
+
+func tableOf(statement string) string {
+	fields := strings.Fields(statement)
+	for i, field := range fields {
+		switch strings.ToUpper(field) {
+		case "INTO", "UPDATE", "FROM":
+			if i+1 < len(fields) {
+				return fields[i+1]
+			}
+		}
+	}
+
+	return "unknown"
+}
+
+func recordedTables(recorder *Recorder) (tables []RecordedTable) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	for _, table := range recorder.tables {
+		tables = append(tables, *table)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Table < tables[j].Table
+	})
+
+	return
+}
+
+// PrintDryRun writes a human readable summary of the recorded writes.
+func PrintDryRun(recorder *Recorder, w io.Writer) {
+	for _, table := range recordedTables(recorder) {
+		fmt.Fprintf(w, "%s: %d rows, %d skipped because they were manually corrected\n", table.Table, table.Rows, len(table.Skipped))
+		for _, statement := range table.Statements {
+			fmt.Fprintf(w, "  %s\n", statement)
+		}
+		for _, skipped := range table.Skipped {
+			fmt.Fprintf(w, "  skipped %v\n", skipped.Key)
+		}
+	}
+}
+
+// WriteDryRun writes the recorded writes as JSON.
+func WriteDryRun(recorder *Recorder, w io.Writer) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(recordedTables(recorder))
+	if err != nil {
+		internal.ProcessError(err)
+	}
+}
@@ -0,0 +1,34 @@
+package metricsdatabase
+
+import "testing"
+
+func TestUpdatePattern(t *testing.T) {
+	tests := []struct {
+		statement string
+		table     string
+		where     string
+	}{
+		{"UPDATE base_data.issues SET type = ? WHERE adapter = ? AND repository_id = ? AND id = ? IF manually_corrected != true", "base_data.issues", "adapter = ? AND repository_id = ? AND id = ?"},
+		{"UPDATE base_data.issues USING TTL ? SET type = ? WHERE adapter = ? AND id = ? IF manually_corrected != true", "base_data.issues", "adapter = ? AND id = ?"},
+		{"update test_base.commits using ttl ? set created_at = ? where adapter = ? and id = ? if manually_corrected!=true", "test_base.commits", "adapter = ? and id = ?"},
+		{"UPDATE base_data.leases USING TTL ? SET owner = ? WHERE name = ? IF owner = ?", "", ""},
+		{"UPDATE base_data.issues SET type = ?, manually_corrected = true WHERE adapter = ? AND id = ?", "", ""},
+		{"INSERT INTO base_data.issues (id) VALUES (?) IF NOT EXISTS", "", ""},
+	}
+
+	for _, test := range tests {
+		match := updatePattern.FindStringSubmatch(test.statement)
+		if test.table == "" {
+			if match != nil {
+				t.Errorf("updatePattern matches %q", test.statement)
+			}
+			continue
+		}
+
+		if match == nil {
+			t.Errorf("updatePattern doesn't match %q", test.statement)
+		} else if match[1] != test.table || match[2] != test.where {
+			t.Errorf("updatePattern(%q) = %q, %q, want %q, %q", test.statement, match[1], match[2], test.table, test.where)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package metricsdatabase
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+)
+
+func InsertChanges(ctx context.Context, changes []internal.Change, client *DatabaseClient) []storage.RowError {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var values [][]any
+	for _, change := range changes {
+		rowTtl, keep := ttl(client, storage.TableChanges, change.ChangedAt)
+		if !keep {
+			continue
+		}
+
+		values = append(values, []any{change.Adapter, change.RepositoryId, change.Entity, change.Id, change.ChangedAt, change.Field, change.OldValue, change.NewValue, change.Source, rowTtl})
+	}
+
+	return InsertBatch(ctx, client, "INSERT INTO base_data.changes (adapter, repository_id, entity, id, changed_at, field, old_value, new_value, source) VALUES (?,?,?,?,?,?,?,?,?) USING TTL ?", values)
+}
+
+// ListChanges returns the history of one item, newest first.
+func ListChanges(ctx context.Context, client *DatabaseClient, adapter string, repositoryId string, entity string, id string) (changes []internal.Change, err error) {
+	err = scanRows(ctx, client, "SELECT changed_at, field, old_value, new_value, source FROM base_data.changes WHERE adapter = ? AND repository_id = ? AND entity = ? AND id = ?", []any{adapter, repositoryId, entity, id}, func(scanner gocql.Scanner) error {
+		change := internal.Change{Adapter: adapter, RepositoryId: repositoryId, Entity: entity, Id: id}
+		var oldValue, newValue, source *string
+		if err := scanner.Scan(&change.ChangedAt, &change.Field, &oldValue, &newValue, &source); err != nil {
+			return err
+		}
+
+		change.OldValue = value(oldValue)
+		change.NewValue = value(newValue)
+		change.Source = value(source)
+		changes = append(changes, change)
+		return nil
+	})
+
+	return
+}
@@ -0,0 +1,55 @@
+package metricsdatabase
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"log/slog"
+	"thesis/scraper/internal"
+	"time"
+)
+
+// RegisterInstance announces a running scraper instance. The row expires after
+// ttl unless it is registered again, so instances that crashed drop out of the
+// list on their own. A failed registration is logged and repeated by the next
+// heartbeat.
+func RegisterInstance(client *DatabaseClient, id string, startedAt time.Time, ttl time.Duration) {
+	if IsDryRun(client) {
+		return
+	}
+
+	Connect(client)
+
+	if client.session != nil {
+		err := query(client, "INSERT INTO base_data.scraper_instances (id, started_at, heartbeat_at) VALUES (?,?,?) USING TTL ?",
+			id, startedAt, time.Now(), ttlSeconds(ttl)).Exec()
+		if err != nil {
+			slog.Warn("Could not register instance", "instance", id, internal.ErrorAttr(err))
+		}
+	}
+}
+
+func UnregisterInstance(client *DatabaseClient, id string) {
+	if IsDryRun(client) || !IsConnected(client) {
+		return
+	}
+
+	err := query(client, "DELETE FROM base_data.scraper_instances WHERE id = ?", id).Exec()
+	if err != nil {
+		// The row expires on its own
+		slog.Warn("Could not unregister instance", "instance", id, internal.ErrorAttr(err))
+	}
+}
+
+func ListInstances(client *DatabaseClient) (ids []string, err error) {
+	err = scanRows(context.Background(), client, "SELECT id FROM base_data.scraper_instances", nil, func(scanner gocql.Scanner) error {
+		var id string
+		if err := scanner.Scan(&id); err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+		return nil
+	})
+
+	return
+}
@@ -0,0 +1,53 @@
+package metricsdatabase
+
+import (
+	"github.com/gocql/gocql"
+	"regexp"
+)
+
+// Statements are written against the default keyspaces and tables and are
+// rewritten to the configured names right before they are executed.
+const (
+	defaultBaseDataKeyspace = "base_data"
+	defaultMetricsKeyspace  = "metrics"
+)
+
+var qualifiedName = regexp.MustCompile(`\b(base_data|metrics)\.(\w+)\b`)
+var keyspaceName = regexp.MustCompile(`(?i)\b(keyspace\s+(?:if\s+not\s+exists\s+)?)(base_data|metrics)\b`)
+
+func keyspace(client *DatabaseClient, name string) string {
+	switch {
+	case name == defaultBaseDataKeyspace && client.config.Keyspace != "":
+		return client.config.Keyspace
+	case name == defaultMetricsKeyspace && client.config.MetricsKeyspace != "":
+		return client.config.MetricsKeyspace
+	}
+
+	return name
+}
+
+func tableName(client *DatabaseClient, name string) string {
+	if renamed, ok := client.config.Tables[name]; ok && renamed != "" {
+		return renamed
+	}
+
+	return name
+}
+
+// qualify replaces the default keyspace and table names in statement with the
+// configured ones.
+func qualify(client *DatabaseClient, statement string) string {
+	statement = keyspaceName.ReplaceAllStringFunc(statement, func(match string) string {
+		parts := keyspaceName.FindStringSubmatch(match)
+		return parts[1] + keyspace(client, parts[2])
+	})
+
+	return qualifiedName.ReplaceAllStringFunc(statement, func(match string) string {
+		parts := qualifiedName.FindStringSubmatch(match)
+		return keyspace(client, parts[1]) + "." + tableName(client, parts[2])
+	})
+}
+
+func query(client *DatabaseClient, statement string, values ...any) *gocql.Query {
+	return client.session.Query(qualify(client, statement), values...)
+}
@@ -0,0 +1,37 @@
+package metricsdatabase
+
+import (
+	"testing"
+	"thesis/scraper/internal"
+)
+
+func TestQualify(t *testing.T) {
+	renamed := &DatabaseClient{config: internal.DatabaseConfig{
+		Keyspace:        "scraper",
+		MetricsKeyspace: "scraper_metrics",
+		Tables:          map[string]string{"issues": "scraped_issues", "lead_times": ""},
+	}}
+
+	tests := []struct {
+		name      string
+		client    *DatabaseClient
+		statement string
+		want      string
+	}{
+		{"defaults", &DatabaseClient{}, "SELECT id FROM base_data.issues WHERE adapter = ?", "SELECT id FROM base_data.issues WHERE adapter = ?"},
+		{"keyspace", renamed, "SELECT id FROM base_data.commits", "SELECT id FROM scraper.commits"},
+		{"table", renamed, "SELECT id FROM base_data.issues", "SELECT id FROM scraper.scraped_issues"},
+		{"empty table name", renamed, "SELECT issue_id FROM metrics.lead_times", "SELECT issue_id FROM scraper_metrics.lead_times"},
+		{"several names", renamed, "INSERT INTO metrics.deployment_frequencies SELECT * FROM base_data.deployments", "INSERT INTO scraper_metrics.deployment_frequencies SELECT * FROM scraper.deployments"},
+		{"create keyspace", renamed, "CREATE KEYSPACE IF NOT EXISTS base_data WITH replication = {}", "CREATE KEYSPACE IF NOT EXISTS scraper WITH replication = {}"},
+		{"use keyspace", renamed, "ALTER keyspace metrics WITH durable_writes = true", "ALTER keyspace scraper_metrics WITH durable_writes = true"},
+		{"column named like a keyspace", renamed, "SELECT metrics FROM base_data.repositories", "SELECT metrics FROM scraper.repositories"},
+		{"longer keyspace", renamed, "SELECT id FROM base_data_old.issues", "SELECT id FROM base_data_old.issues"},
+	}
+
+	for _, test := range tests {
+		if got := qualify(test.client, test.statement); got != test.want {
+			t.Errorf("%s: qualify(%q) = %q, want %q", test.name, test.statement, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package metricsdatabase
+
+import (
+	"log/slog"
+	"thesis/scraper/internal"
+	"time"
+)
+
+// TryAcquireLease takes the lease with the given name for owner, unless another
+// owner holds it. The row backing a lease is written with a TTL, so a lease of
+// a crashed holder expires on its own.
+func TryAcquireLease(client *DatabaseClient, name string, owner string, duration time.Duration) bool {
+	// A dry run doesn't write leases, so it never blocks a real run
+	if IsDryRun(client) {
+		return true
+	}
+
+	Connect(client)
+
+	if client.session == nil {
+		return false
+	}
+
+	now := time.Now()
+	existing := make(map[string]interface{})
+	applied, err := query(client, "INSERT INTO base_data.leases (name, owner, acquired_at, expires_at) VALUES (?,?,?,?) IF NOT EXISTS USING TTL ?",
+		name, owner, now, now.Add(duration), ttlSeconds(duration)).MapScanCAS(existing)
+	if err != nil {
+		slog.Warn("Could not acquire lease", "lease", name, internal.ErrorAttr(err))
+		return false
+	}
+
+	if !applied {
+		// Re-entering a lease we still hold, e.g. after a restart with a fixed instance name
+		if existing["owner"] != owner {
+			return false
+		}
+		return RenewLease(client, name, owner, duration)
+	}
+
+	return true
+}
+
+func RenewLease(client *DatabaseClient, name string, owner string, duration time.Duration) bool {
+	if IsDryRun(client) {
+		return true
+	}
+
+	if !IsConnected(client) {
+		return false
+	}
+
+	existing := make(map[string]interface{})
+	applied, err := query(client, "UPDATE base_data.leases USING TTL ? SET owner = ?, expires_at = ? WHERE name = ? IF owner = ?",
+		ttlSeconds(duration), owner, time.Now().Add(duration), name, owner).MapScanCAS(existing)
+	if err != nil {
+		slog.Warn("Could not renew lease", "lease", name, internal.ErrorAttr(err))
+		return false
+	}
+
+	return applied
+}
+
+// DeleteLease deletes the lease, as long as it is still held by owner.
+func DeleteLease(client *DatabaseClient, name string, owner string) {
+	if IsDryRun(client) || !IsConnected(client) {
+		return
+	}
+
+	existing := make(map[string]interface{})
+	_, err := query(client, "DELETE FROM base_data.leases WHERE name = ? IF owner = ?", name, owner).MapScanCAS(existing)
+	if err != nil {
+		// The lease expires on its own
+		slog.Warn("Could not delete lease", "lease", name, internal.ErrorAttr(err))
+	}
+}
+
+func ttlSeconds(duration time.Duration) int {
+	seconds := int(duration.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return seconds
+}
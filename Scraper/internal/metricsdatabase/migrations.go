@@ -0,0 +1,180 @@
+package metricsdatabase
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+//go:embed migrations/*.cql
+var migrations embed.FS
+
+// backfills fill new tables with existing data after their migration, where
+// that can't be done in CQL.
+var backfills = map[string]func(client *DatabaseClient) error{
+	"008_repository_lookups": backfillRepositoryLookups,
+}
+
+// MigrateUp applies all migrations that were not applied yet, in the order of
+// their versions, and returns the versions it applied.
+func MigrateUp(client *DatabaseClient) (versions []string) {
+	Connect(client)
+
+	execute(client, "create keyspace if not exists base_data with replication = {'class': 'SimpleStrategy', 'replication_factor': 1}")
+	execute(client, "create table if not exists base_data.schema_migrations (version TEXT, applied_at TIMESTAMP, scraper_version TEXT, primary key (version))")
+
+	applied, err := appliedMigrations(client)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	for _, version := range migrationVersions() {
+		if _, ok := applied[version]; ok {
+			continue
+		}
+
+		for _, statement := range migrationStatements(version) {
+			err := query(client, statement).Exec()
+			// Migrations may run against a schema that was created by hand
+			if err != nil && !strings.Contains(err.Error(), "conflicts with an existing column") {
+				internal.ProcessError(fmt.Errorf("migration %s: %w", version, err))
+			}
+		}
+
+		if backfill, ok := backfills[version]; ok {
+			if err := backfill(client); err != nil {
+				internal.ProcessError(fmt.Errorf("migration %s: %w", version, err))
+			}
+		}
+
+		execute(client, "INSERT INTO base_data.schema_migrations (version, applied_at, scraper_version) VALUES (?,?,?)", version, time.Now(), internal.Version)
+		slog.Info("Applied migration", "backend", "cassandra", "version", version)
+
+		versions = append(versions, version)
+	}
+
+	return
+}
+
+// MigrationStatus lists the migrations known to this binary and the ones found
+// in the database, ordered by version.
+func MigrationStatus(client *DatabaseClient) (status []storage.Migration) {
+	Connect(client)
+
+	applied, err := appliedMigrations(client)
+	if err != nil {
+		slog.Warn("Could not read the applied migrations", internal.ErrorAttr(err))
+	}
+
+	known := migrationVersions()
+	versions := slices.Clone(known)
+	for version := range applied {
+		if !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+
+	for _, version := range versions {
+		migration := storage.Migration{Version: version, Known: slices.Contains(known, version)}
+		if appliedAt, ok := applied[version]; ok {
+			migration.AppliedAt = &appliedAt
+		}
+
+		status = append(status, migration)
+	}
+
+	return
+}
+
+// CheckSchema returns an error if any migration of this binary was not applied.
+func CheckSchema(client *DatabaseClient) error {
+	Connect(client)
+
+	applied, err := appliedMigrations(client)
+	if err != nil {
+		return fmt.Errorf("could not read the schema version, run `scraper migrate up` first: %w", err)
+	}
+
+	var pending []string
+	for _, version := range migrationVersions() {
+		if _, ok := applied[version]; !ok {
+			pending = append(pending, version)
+		}
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("the Cassandra schema is outdated, migrations %s are pending, run `scraper migrate up` first", strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+func appliedMigrations(client *DatabaseClient) (map[string]time.Time, error) {
+	if client.session == nil {
+		return nil, fmt.Errorf("not connected to Cassandra")
+	}
+
+	applied := make(map[string]time.Time)
+
+	var version string
+	var appliedAt time.Time
+	iter := query(client, "SELECT version, applied_at FROM base_data.schema_migrations").Consistency(client.readConsistency).Iter()
+	for iter.Scan(&version, &appliedAt) {
+		applied[version] = appliedAt
+	}
+
+	return applied, iter.Close()
+}
+
+func migrationVersions() (versions []string) {
+	names, err := fs.Glob(migrations, "migrations/*.cql")
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	for _, name := range names {
+		versions = append(versions, strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".cql"))
+	}
+	sort.Strings(versions)
+
+	return
+}
+
+// migrationStatements splits a migration into its statements, as Cassandra
+// only executes one statement per query.
+func migrationStatements(version string) (statements []string) {
+	content, err := migrations.ReadFile("migrations/" + version + ".cql")
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return
+}
+
+func execute(client *DatabaseClient, statement string, values ...any) {
+	err := query(client, statement, values...).Exec()
+	if err != nil {
+		internal.ProcessError(err)
+	}
+}
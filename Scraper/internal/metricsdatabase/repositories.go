@@ -0,0 +1,162 @@
+package metricsdatabase
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"log/slog"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+)
+
+// lookupChunkSize is the number of repositories read with one IN query.
+const lookupChunkSize = 100
+
+func ListRepositories(ctx context.Context, adapter internal.Adapter, client *DatabaseClient) ([]internal.Repository, error) {
+	return listRepositories(ctx, client, adapter.Name, "SELECT id FROM base_data.repositories_by_adapter WHERE adapter = ?", adapter.Name)
+}
+
+// ListRepositoriesByGroupingKey returns the repositories whose metrics are
+// grouped under groupingKey.
+func ListRepositoriesByGroupingKey(ctx context.Context, adapter internal.Adapter, groupingKey string, client *DatabaseClient) ([]internal.Repository, error) {
+	return listRepositories(ctx, client, adapter.Name, "SELECT id FROM base_data.repositories_by_grouping_key WHERE adapter = ? AND grouping_key = ?", adapter.Name, groupingKey)
+}
+
+// listRepositories reads the ids from a lookup table and then the rows of
+// those repositories by their partition key.
+func listRepositories(ctx context.Context, client *DatabaseClient, adapter string, lookup string, values ...any) (repos []internal.Repository, err error) {
+	var ids []string
+	err = scanRows(ctx, client, lookup, values, func(scanner gocql.Scanner) error {
+		var id string
+		if err := scanner.Scan(&id); err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(ids); i += lookupChunkSize {
+		end := min(i+lookupChunkSize, len(ids))
+
+		err = scanRows(ctx, client, "SELECT id, full_name, default_branch, grouping_key, created_at, updated_at FROM base_data.repositories WHERE adapter = ? AND id IN ?", []any{adapter, ids[i:end]}, func(scanner gocql.Scanner) error {
+			var row repositoryRow
+			if err := scanner.Scan(&row.Id, &row.FullName, &row.DefaultBranch, &row.GroupingKey, &row.CreatedAt, &row.UpdatedAt); err != nil {
+				return err
+			}
+
+			repos = append(repos, internal.Repository{
+				Id:            row.Id,
+				FullName:      value(row.FullName),
+				DefaultBranch: value(row.DefaultBranch),
+				CreatedAt:     value(row.CreatedAt),
+				UpdatedAt:     value(row.UpdatedAt),
+				GroupingKey:   value(row.GroupingKey),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// storedRepository returns a stored repository and whether it was manually
+// corrected, or nil if the repository isn't stored yet.
+func storedRepository(ctx context.Context, client *DatabaseClient, adapter string, id string) (repo *internal.Repository, corrected bool, err error) {
+	err = scanRows(ctx, client, "SELECT id, full_name, default_branch, grouping_key, created_at, updated_at, manually_corrected FROM base_data.repositories WHERE adapter = ? AND id = ?", []any{adapter, id}, func(scanner gocql.Scanner) error {
+		var row repositoryRow
+		if err := scanner.Scan(&row.Id, &row.FullName, &row.DefaultBranch, &row.GroupingKey, &row.CreatedAt, &row.UpdatedAt, &row.ManuallyCorrected); err != nil {
+			return err
+		}
+
+		repo = &internal.Repository{
+			Id:            row.Id,
+			FullName:      value(row.FullName),
+			DefaultBranch: value(row.DefaultBranch),
+			CreatedAt:     value(row.CreatedAt),
+			UpdatedAt:     value(row.UpdatedAt),
+			GroupingKey:   value(row.GroupingKey),
+		}
+		corrected = value(row.ManuallyCorrected)
+		return nil
+	})
+
+	return
+}
+
+// storedGroupingKey returns the grouping key of a stored repository, or nil if
+// the repository isn't stored yet.
+func storedGroupingKey(ctx context.Context, client *DatabaseClient, adapter string, id string) (groupingKey *string, err error) {
+	err = scanRows(ctx, client, "SELECT grouping_key FROM base_data.repositories WHERE adapter = ? AND id = ?", []any{adapter, id}, func(scanner gocql.Scanner) error {
+		var key *string
+		if err := scanner.Scan(&key); err != nil {
+			return err
+		}
+
+		stored := value(key)
+		groupingKey = &stored
+		return nil
+	})
+
+	return
+}
+
+// indexRepository adds a repository to the lookup tables, under the grouping
+// key that is actually stored, which differs from the scraped one if it was
+// corrected. previous is the grouping key before the write.
+func indexRepository(ctx context.Context, client *DatabaseClient, adapter string, id string, previous *string) (failures []storage.RowError) {
+	current, err := storedGroupingKey(ctx, client, adapter, id)
+	if err != nil {
+		slog.Warn("Could not index repository", "adapter", adapter, "repository", id, internal.ErrorAttr(err))
+		return
+	}
+	if current == nil {
+		return
+	}
+
+	if previous != nil && *previous != *current {
+		// Unconditional writes, which UpdateBatch batches like inserts
+		failures = UpdateBatch(ctx, client, "DELETE FROM base_data.repositories_by_grouping_key WHERE adapter = ? AND grouping_key = ? AND id = ?", [][]any{{adapter, *previous, id}})
+	}
+
+	failures = append(failures, InsertBatch(ctx, client, "INSERT INTO base_data.repositories_by_adapter (adapter, id) VALUES (?,?)", [][]any{{adapter, id}})...)
+	failures = append(failures, InsertBatch(ctx, client, "INSERT INTO base_data.repositories_by_grouping_key (adapter, grouping_key, id) VALUES (?,?,?)", [][]any{{adapter, *current, id}})...)
+
+	return
+}
+
+// backfillRepositoryLookups fills the lookup tables with the repositories
+// stored before they existed. It scans base_data.repositories once.
+func backfillRepositoryLookups(client *DatabaseClient) error {
+	ctx := context.Background()
+
+	var byAdapter, byGroupingKey [][]any
+	err := scanRows(ctx, client, "SELECT adapter, id, grouping_key FROM base_data.repositories", nil, func(scanner gocql.Scanner) error {
+		var adapter, id string
+		var groupingKey *string
+		if err := scanner.Scan(&adapter, &id, &groupingKey); err != nil {
+			return err
+		}
+
+		byAdapter = append(byAdapter, []any{adapter, id})
+		byGroupingKey = append(byGroupingKey, []any{adapter, value(groupingKey), id})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	failures := InsertBatch(ctx, client, "INSERT INTO base_data.repositories_by_adapter (adapter, id) VALUES (?,?)", byAdapter)
+	failures = append(failures, InsertBatch(ctx, client, "INSERT INTO base_data.repositories_by_grouping_key (adapter, grouping_key, id) VALUES (?,?,?)", byGroupingKey)...)
+	if len(failures) > 0 {
+		return fmt.Errorf("%d repositories could not be indexed", len(failures))
+	}
+
+	return nil
+}
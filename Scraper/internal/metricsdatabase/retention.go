@@ -0,0 +1,128 @@
+package metricsdatabase
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"strings"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// maxTtl is the longest TTL Cassandra accepts, 20 years.
+const maxTtl = 630720000
+
+type pruneColumn struct {
+	name      string
+	timestamp bool
+}
+
+// pruneTable describes how the rows of a table are found and deleted. age is
+// the column the age is read from.
+type pruneTable struct {
+	name string
+	keys []pruneColumn
+	age  string
+}
+
+var baseDataKeys = []pruneColumn{{"adapter", false}, {"repository_id", false}, {"id", false}}
+
+var pruneTables = map[string]pruneTable{
+	storage.TableIssues:                {"base_data.issues", baseDataKeys, "created_at"},
+	storage.TableCommits:               {"base_data.commits", baseDataKeys, "created_at"},
+	storage.TablePullRequests:          {"base_data.pull_requests", baseDataKeys, "created_at"},
+	storage.TableDeployments:           {"base_data.deployments", baseDataKeys, "created_at"},
+	storage.TableEnvironments:          {"base_data.environments", baseDataKeys, "created_at"},
+	storage.TableDeploymentFrequencies: {"metrics.deployment_frequencies", []pruneColumn{{"adapter", false}, {"grouping_key", false}, {"repository_id", false}, {"date", true}}, "date"},
+	storage.TableLeadTimes:             {"metrics.lead_times", []pruneColumn{{"adapter", false}, {"repository_id", false}, {"issue_id", false}}, "issue_created_at"},
+	storage.TableTimesToRestoreService: {"metrics.times_to_restore_service", []pruneColumn{{"adapter", false}, {"repository_id", false}, {"issue_id", false}}, "issue_created_at"},
+	storage.TableScrapeRuns:            {"base_data.scrape_runs", []pruneColumn{{"adapter", false}, {"repository_id", false}, {"stage", false}, {"started_at", true}, {"run_id", false}}, "started_at"},
+	storage.TableChanges:               {"base_data.changes", []pruneColumn{{"adapter", false}, {"repository_id", false}, {"entity", false}, {"id", false}, {"changed_at", true}, {"field", false}}, "changed_at"},
+}
+
+// EnableRetention makes every following write expire its rows once they are
+// older than the retention of their table.
+func EnableRetention(client *DatabaseClient, retention map[string]time.Duration) {
+	client.retention = retention
+}
+
+// ttl returns the TTL in seconds for a row of table whose age is measured from
+// since, or 0 if the table is kept forever. keep is false for rows that are
+// already past their retention, which aren't written at all.
+func ttl(client *DatabaseClient, table string, since time.Time) (seconds int, keep bool) {
+	retention := client.retention[table]
+	if retention <= 0 {
+		return 0, true
+	}
+
+	if since.IsZero() {
+		since = time.Now()
+	}
+
+	seconds = int(time.Until(since.Add(retention)).Seconds())
+	if seconds < 1 {
+		return 0, false
+	}
+
+	return min(seconds, maxTtl), true
+}
+
+// Prune deletes the rows of table that are older than before. Cassandra can't
+// delete by a regular column, so it reads the keys and the age of every row of
+// the table and deletes the old ones by their key.
+func Prune(ctx context.Context, table string, before time.Time, client *DatabaseClient) (int, error) {
+	definition, ok := pruneTables[table]
+	if !ok {
+		return 0, fmt.Errorf("%q can't be pruned", table)
+	}
+
+	var keys, conditions []string
+	for _, key := range definition.keys {
+		keys = append(keys, key.name)
+		conditions = append(conditions, key.name+" = ?")
+	}
+
+	var rows [][]any
+	err := scanRows(ctx, client, fmt.Sprintf("SELECT %s, %s FROM %s", strings.Join(keys, ", "), definition.age, definition.name), nil, func(scanner gocql.Scanner) error {
+		var destinations []any
+		for _, key := range definition.keys {
+			if key.timestamp {
+				destinations = append(destinations, new(time.Time))
+			} else {
+				destinations = append(destinations, new(string))
+			}
+		}
+
+		var age *time.Time
+		destinations = append(destinations, &age)
+
+		if err := scanner.Scan(destinations...); err != nil {
+			return err
+		}
+
+		// Rows without an age were written before it was recorded
+		if age == nil || !age.Before(before) {
+			return nil
+		}
+
+		var row []any
+		for _, destination := range destinations[:len(definition.keys)] {
+			switch destination := destination.(type) {
+			case *string:
+				row = append(row, *destination)
+			case *time.Time:
+				row = append(row, *destination)
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Unconditional writes, which UpdateBatch batches like inserts
+	failures := UpdateBatch(ctx, client, fmt.Sprintf("DELETE FROM %s WHERE %s", definition.name, strings.Join(conditions, " AND ")), rows)
+
+	return len(rows) - len(failures), nil
+}
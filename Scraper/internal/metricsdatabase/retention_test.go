@@ -0,0 +1,39 @@
+package metricsdatabase
+
+import (
+	"testing"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+func TestTtl(t *testing.T) {
+	client := &DatabaseClient{}
+	EnableRetention(client, map[string]time.Duration{
+		storage.TableIssues:    30 * 24 * time.Hour,
+		storage.TableLeadTimes: 100 * 365 * 24 * time.Hour,
+	})
+
+	now := time.Now()
+	tests := []struct {
+		name  string
+		table string
+		since time.Time
+		min   int
+		max   int
+		keep  bool
+	}{
+		{"no retention", storage.TableCommits, now.Add(-1000 * 24 * time.Hour), 0, 0, true},
+		{"new row", storage.TableIssues, now, 30*24*3600 - 5, 30 * 24 * 3600, true},
+		{"aged row", storage.TableIssues, now.Add(-20 * 24 * time.Hour), 10*24*3600 - 5, 10 * 24 * 3600, true},
+		{"expired row", storage.TableIssues, now.Add(-31 * 24 * time.Hour), 0, 0, false},
+		{"unknown age", storage.TableIssues, time.Time{}, 30*24*3600 - 5, 30 * 24 * 3600, true},
+		{"capped", storage.TableLeadTimes, now, maxTtl, maxTtl, true},
+	}
+
+	for _, test := range tests {
+		seconds, keep := ttl(client, test.table, test.since)
+		if keep != test.keep || seconds < test.min || seconds > test.max {
+			t.Errorf("%s: ttl = %d, %v, want %d-%d, %v", test.name, seconds, keep, test.min, test.max, test.keep)
+		}
+	}
+}
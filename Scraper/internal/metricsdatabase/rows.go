@@ -0,0 +1,148 @@
+package metricsdatabase
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/tracing"
+	"time"
+)
+
+// defaultPageSize is the number of rows fetched per page, unless configured.
+const defaultPageSize = 5000
+
+// The rows of the base data tables. Columns that may be null are pointers,
+// so a missing value can't be mistaken for a zero one.
+
+type repositoryRow struct {
+	Id            string
+	FullName      *string
+	DefaultBranch *string
+	GroupingKey   *string
+	CreatedAt     *time.Time
+	UpdatedAt     *time.Time
+
+	ManuallyCorrected *bool
+}
+
+type issueRow struct {
+	Id                string
+	PullRequestIds    []string
+	CreatedAt         *time.Time
+	ClosedAt          *time.Time
+	Type              *string
+	DeletedAt         *time.Time
+	ManuallyCorrected *bool
+}
+
+type commitRow struct {
+	Id        string
+	CreatedAt *time.Time
+}
+
+type pullRequestRow struct {
+	Id                string
+	Head              *headUdt
+	Base              *headUdt
+	IssueIds          []string
+	CommitIds         []string
+	CreatedAt         *time.Time
+	ClosedAt          *time.Time
+	MergedAt          *time.Time
+	DeletedAt         *time.Time
+	ManuallyCorrected *bool
+}
+
+type deploymentRow struct {
+	Id                string
+	Sha               *string
+	CommitId          *string
+	Ref               *string
+	Task              *string
+	EnvironmentId     *string
+	CreatedAt         *time.Time
+	UpdatedAt         *time.Time
+	DeletedAt         *time.Time
+	ManuallyCorrected *bool
+}
+
+type environmentRow struct {
+	Id                string
+	Name              *string
+	CreatedAt         *time.Time
+	UpdatedAt         *time.Time
+	DeletedAt         *time.Time
+	ManuallyCorrected *bool
+}
+
+// headUdt is the base_data.head type.
+type headUdt struct {
+	Ref *string `cql:"ref"`
+	Id  *string `cql:"id"`
+}
+
+// head converts the type, an unknown head is empty rather than nil, since the
+// aggregation follows the refs of every pull request.
+func (h *headUdt) head() *internal.Head {
+	if h == nil {
+		return &internal.Head{}
+	}
+
+	return &internal.Head{Ref: value(h.Ref), Sha: value(h.Id)}
+}
+
+// value returns the zero value for a null column.
+func value[T any](pointer *T) (value T) {
+	if pointer != nil {
+		value = *pointer
+	}
+
+	return
+}
+
+// scanRows runs a read and calls scan for every row. gocql fetches the pages
+// of pageSize rows one after the other while the rows are scanned. A failed
+// query or a row that can't be decoded is returned as an error.
+func scanRows(ctx context.Context, client *DatabaseClient, statement string, values []any, scan func(scanner gocql.Scanner) error) error {
+	ctx, span := startStatementSpan(ctx, "List", qualify(client, statement), 0)
+	defer span.End()
+
+	Connect(client)
+
+	if client.session == nil {
+		return nil
+	}
+
+	iter := query(client, statement, values...).
+		Consistency(client.readConsistency).
+		PageSize(pageSize(client)).
+		WithContext(ctx).
+		Iter()
+
+	scanner := iter.Scanner()
+	for scanner.Next() {
+		if err := scan(scanner); err != nil {
+			iter.Close()
+			err = fmt.Errorf("could not decode row of %s: %w", qualify(client, statement), err)
+			tracing.RecordError(span, err)
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		err = fmt.Errorf("could not read %s: %w", qualify(client, statement), err)
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func pageSize(client *DatabaseClient) int {
+	if client.config.PageSize > 0 {
+		return client.config.PageSize
+	}
+
+	return defaultPageSize
+}
@@ -0,0 +1,89 @@
+package metricsdatabase
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"sort"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+)
+
+// InsertScrapeRun writes the whole run, so it is called once when the run
+// starts and again when it finishes.
+func InsertScrapeRun(ctx context.Context, run internal.ScrapeRun, client *DatabaseClient) {
+	statement := "INSERT INTO base_data.scrape_runs (adapter, repository_id, stage, started_at, run_id, finished_at, status, counts, errors, instance, scraper_version) VALUES (?,?,?,?,?,?,?,?,?,?,?) USING TTL ?"
+	rowTtl, keep := ttl(client, storage.TableScrapeRuns, run.StartedAt)
+	if !keep {
+		return
+	}
+	values := []any{run.Adapter, run.RepositoryId, run.Stage, run.StartedAt, run.RunId, run.FinishedAt, run.Status, run.Counts, run.Errors, run.Instance, run.ScraperVersion, rowTtl}
+
+	if IsDryRun(client) {
+		record(ctx, client, qualify(client, statement), [][]any{values})
+		return
+	}
+
+	Connect(client)
+
+	if client.session != nil {
+		err := query(client, statement, values...).WithContext(ctx).Exec()
+		if err != nil {
+			internal.ProcessError(err)
+		}
+	}
+}
+
+// ListScrapeRuns returns the latest runs, newest first. With an adapter and a
+// repository it reads the partition of each stage, otherwise it has to scan the
+// whole table, which is fine for the amount of runs the CLI is meant to look at.
+func ListScrapeRuns(ctx context.Context, client *DatabaseClient, adapter string, repositoryId string, limit int) (runs []internal.ScrapeRun, err error) {
+	statement := "SELECT adapter, repository_id, stage, started_at, run_id, finished_at, status, counts, errors, instance, scraper_version FROM base_data.scrape_runs"
+
+	scan := func(scanner gocql.Scanner) error {
+		var run internal.ScrapeRun
+		var status, instance, scraperVersion *string
+		if err := scanner.Scan(&run.Adapter, &run.RepositoryId, &run.Stage, &run.StartedAt, &run.RunId, &run.FinishedAt, &status, &run.Counts, &run.Errors, &instance, &scraperVersion); err != nil {
+			return err
+		}
+		if (adapter != "" && run.Adapter != adapter) || (repositoryId != "" && run.RepositoryId != repositoryId) {
+			return nil
+		}
+
+		run.Status = value(status)
+		run.Instance = value(instance)
+		run.ScraperVersion = value(scraperVersion)
+		runs = append(runs, run)
+		return nil
+	}
+
+	if adapter == "" || repositoryId == "" {
+		err = scanRows(ctx, client, statement, nil, scan)
+	} else {
+		// Each stage is read on its own, so the runs of one stage can't fill the
+		// limit before the other is read
+		statement += " WHERE adapter = ? AND repository_id = ? AND stage = ?"
+		if limit > 0 {
+			statement += fmt.Sprintf(" LIMIT %d", limit)
+		}
+
+		for _, stage := range []string{internal.RunStageScrape, internal.RunStageAggregate} {
+			if err = scanRows(ctx, client, statement, []any{adapter, repositoryId, stage}, scan); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return
+}
@@ -0,0 +1,176 @@
+package metricsdatabase
+
+import (
+	"context"
+	"errors"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+var _ storage.Store = (*Store)(nil)
+
+// Store implements storage.Store on top of the Cassandra keyspaces.
+type Store struct {
+	Client *DatabaseClient
+}
+
+func NewStore(client *DatabaseClient) *Store {
+	return &Store{Client: client}
+}
+
+func (s *Store) InsertRepository(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Change, []storage.RowError) {
+	return InsertRepository(ctx, adapter, repository, s.Client)
+}
+
+func (s *Store) InsertIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository, issues []internal.Issue) ([]internal.Change, []storage.RowError) {
+	return InsertIssues(ctx, adapter, repository, issues, s.Client)
+}
+
+func (s *Store) InsertCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository, commits []internal.Commit) []storage.RowError {
+	return InsertCommits(ctx, adapter, repository, commits, s.Client)
+}
+
+func (s *Store) InsertPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository, pullRequests []internal.PullRequest) ([]internal.Change, []storage.RowError) {
+	return InsertPullRequests(ctx, adapter, repository, pullRequests, s.Client)
+}
+
+func (s *Store) InsertDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, deployments []internal.Deployment) ([]internal.Change, []storage.RowError) {
+	return InsertDeployments(ctx, adapter, repository, deployments, s.Client)
+}
+
+func (s *Store) InsertEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, environments []internal.Environment) ([]internal.Change, []storage.RowError) {
+	return InsertEnvironments(ctx, adapter, repository, environments, s.Client)
+}
+
+func (s *Store) ListRepositories(ctx context.Context, adapter internal.Adapter) ([]internal.Repository, error) {
+	return ListRepositories(ctx, adapter, s.Client)
+}
+
+func (s *Store) ListIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Issue, error) {
+	return ListIssues(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Commit, error) {
+	return ListCommits(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.PullRequest, error) {
+	return ListPullRequests(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Deployment, error) {
+	return ListDeployments(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Environment, error) {
+	return ListEnvironments(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListIds(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string) ([]string, error) {
+	return ListIds(ctx, adapter, s.Client, repository, entity)
+}
+
+func (s *Store) GetItem(ctx context.Context, adapter internal.Adapter, repositoryId string, entity string, id string) (any, error) {
+	return GetItem(ctx, adapter, s.Client, repositoryId, entity, id)
+}
+
+func (s *Store) MarkDeleted(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string, ids []string, deletedAt time.Time) []storage.RowError {
+	return MarkDeleted(ctx, adapter, repository, entity, ids, deletedAt, s.Client)
+}
+
+func (s *Store) ApplyCorrection(ctx context.Context, correction internal.Correction, values map[string]any) error {
+	return ApplyCorrection(ctx, correction, values, s.Client)
+}
+
+func (s *Store) ListCorrections(ctx context.Context, adapter string, repositoryId string) ([]internal.Correction, error) {
+	return ListCorrections(ctx, s.Client, adapter, repositoryId)
+}
+
+func (s *Store) InsertChanges(ctx context.Context, changes []internal.Change) []storage.RowError {
+	return InsertChanges(ctx, changes, s.Client)
+}
+
+func (s *Store) ListChanges(ctx context.Context, adapter string, repositoryId string, entity string, id string) ([]internal.Change, error) {
+	return ListChanges(ctx, s.Client, adapter, repositoryId, entity, id)
+}
+
+func (s *Store) InsertDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository, frequencies map[string]int) []storage.RowError {
+	return InsertDeploymentFrequency(ctx, adapter, repository, frequencies, s.Client)
+}
+
+func (s *Store) InsertLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository, leadTimes map[string]internal.IssueDuration) []storage.RowError {
+	return InsertLeadTimeForChange(ctx, adapter, repository, leadTimes, s.Client)
+}
+
+func (s *Store) InsertChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository, changeFailureRate float64) []storage.RowError {
+	return InsertChangeFailureRate(ctx, adapter, repository, changeFailureRate, s.Client)
+}
+
+func (s *Store) InsertTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository, timesToRestoreService map[string]internal.IssueDuration) []storage.RowError {
+	return InsertTimesToRestoreService(ctx, adapter, repository, timesToRestoreService, s.Client)
+}
+
+func (s *Store) ListDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]int, error) {
+	return ListDeploymentFrequency(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error) {
+	return ListLeadTimeForChange(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (float64, error) {
+	return ListChangeFailureRate(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) ListTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error) {
+	return ListTimesToRestoreService(ctx, adapter, s.Client, repository)
+}
+
+func (s *Store) Prune(ctx context.Context, table string, before time.Time) (int, error) {
+	return Prune(ctx, table, before, s.Client)
+}
+
+func (s *Store) InsertScrapeRun(ctx context.Context, run internal.ScrapeRun) {
+	InsertScrapeRun(ctx, run, s.Client)
+}
+
+func (s *Store) ListScrapeRuns(ctx context.Context, adapter string, repositoryId string, limit int) ([]internal.ScrapeRun, error) {
+	return ListScrapeRuns(ctx, s.Client, adapter, repositoryId, limit)
+}
+
+func (s *Store) TryAcquireLease(name string, owner string, duration time.Duration) bool {
+	return TryAcquireLease(s.Client, name, owner, duration)
+}
+
+func (s *Store) RenewLease(name string, owner string, duration time.Duration) bool {
+	return RenewLease(s.Client, name, owner, duration)
+}
+
+func (s *Store) DeleteLease(name string, owner string) {
+	DeleteLease(s.Client, name, owner)
+}
+
+func (s *Store) RegisterInstance(id string, startedAt time.Time, ttl time.Duration) {
+	RegisterInstance(s.Client, id, startedAt, ttl)
+}
+
+func (s *Store) UnregisterInstance(id string) {
+	UnregisterInstance(s.Client, id)
+}
+
+func (s *Store) ListInstances() ([]string, error) {
+	return ListInstances(s.Client)
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	if !IsConnected(s.Client) {
+		return errors.New("cassandra session is not connected")
+	}
+
+	return s.Client.session.Query("SELECT now() FROM system.local").WithContext(ctx).Exec()
+}
+
+func (s *Store) Close() {
+	Close(s.Client)
+}
@@ -0,0 +1,185 @@
+package metricsdatabase
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"regexp"
+	"sync"
+	"thesis/scraper/internal/monitoring"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// defaultMaxInFlight bounds the concurrent writes unless maxinflight is configured
+const defaultMaxInFlight = 32
+
+var conditionPattern = regexp.MustCompile(`(?is)\sIF\s`)
+
+// write is a single statement, or an unlogged batch if it has several rows.
+// The rows of a batch always belong to the same partition.
+type write struct {
+	statement string
+	rows      [][]any
+}
+
+// partitionKeys is the number of partition key columns of the tables whose
+// rows are batched.
+var partitionKeys = map[string]int{
+	"repositories":                 2,
+	"issues":                       2,
+	"commits":                      2,
+	"pull_requests":                2,
+	"deployments":                  2,
+	"environments":                 2,
+	"corrections":                  2,
+	"changes":                      4,
+	"scrape_runs":                  3,
+	"repositories_by_adapter":      1,
+	"repositories_by_grouping_key": 2,
+	"deployment_frequencies":       2,
+	"lead_times":                   2,
+	"change_failure_rates":         2,
+	"times_to_restore_service":     2,
+}
+
+// keyedPattern matches the statements whose values start with the partition
+// key. The values of an update start with the assigned columns instead.
+var keyedPattern = regexp.MustCompile(`(?is)^\s*(?:INSERT\s+INTO|DELETE\s+FROM)\s+(?:\w+\.)?(\w+)`)
+
+// partitionKeyColumns returns the number of partition key columns the values
+// of a statement start with, or 0 if they don't.
+func partitionKeyColumns(statement string) int {
+	match := keyedPattern.FindStringSubmatch(statement)
+	if match == nil {
+		return 0
+	}
+
+	return partitionKeys[match[1]]
+}
+
+// batchesByPartition groups rows into batches per partition. Statements whose
+// partition isn't known from their values are sent one by one.
+func batchesByPartition(statement string, values [][]any) (writes []write) {
+	columns := partitionKeyColumns(statement)
+	if columns == 0 {
+		return singleWrites(statement, values)
+	}
+
+	var keys []string
+	partitions := make(map[string][][]any)
+
+	for _, args := range values {
+		key := partitionOf(args, columns)
+		if _, ok := partitions[key]; !ok {
+			keys = append(keys, key)
+		}
+		partitions[key] = append(partitions[key], args)
+	}
+
+	for _, key := range keys {
+		rows := partitions[key]
+		for i := 0; i < len(rows); i += chunkSize {
+			end := i + chunkSize
+			if end > len(rows) {
+				end = len(rows)
+			}
+
+			writes = append(writes, write{statement: statement, rows: rows[i:end]})
+		}
+	}
+
+	return
+}
+
+// singleWrites is used for conditional statements. A batch of them would only
+// be applied if the conditions of all rows hold.
+func singleWrites(statement string, values [][]any) (writes []write) {
+	for _, args := range values {
+		writes = append(writes, write{statement: statement, rows: [][]any{args}})
+	}
+
+	return
+}
+
+// updates sends conditional updates one by one and batches the others.
+func updates(statement string, values [][]any) []write {
+	if conditionPattern.MatchString(statement) {
+		return singleWrites(statement, values)
+	}
+
+	return batchesByPartition(statement, values)
+}
+
+// partitionOf returns the partition of a row from the values of its first
+// columns.
+func partitionOf(args []any, columns int) string {
+	return fmt.Sprintf("%#v", args[:min(columns, len(args))])
+}
+
+// executeWrites runs the writes concurrently, with at most maxinflight of them
+// at the same time, and returns the rows that failed.
+func executeWrites(ctx context.Context, client *DatabaseClient, writes []write) (failures []storage.RowError) {
+	limit := make(chan void, maxInFlight(client))
+	var mutex sync.Mutex
+	var group sync.WaitGroup
+
+	for _, w := range writes {
+		limit <- void{}
+		group.Add(1)
+
+		go func(w write) {
+			defer group.Done()
+			defer func() { <-limit }()
+
+			start := time.Now()
+			err := executeWrite(ctx, client, w)
+			monitoring.ObserveBatch(w.statement, start, err)
+
+			if err != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				for _, args := range w.rows {
+					failures = append(failures, storage.RowError{Statement: w.statement, Args: args, Err: err})
+				}
+			}
+		}(w)
+	}
+
+	group.Wait()
+
+	return
+}
+
+func executeWrite(ctx context.Context, client *DatabaseClient, w write) error {
+	if len(w.rows) == 1 {
+		q := client.session.Query(w.statement, w.rows[0]...).Idempotent(true).WithContext(ctx)
+		if conditionPattern.MatchString(w.statement) {
+			// A condition that doesn't hold, e.g. a manually corrected row, is not a failure
+			_, err := q.MapScanCAS(make(map[string]interface{}))
+			return err
+		}
+
+		return q.Exec()
+	}
+
+	batch := client.session.NewBatch(gocql.UnloggedBatch)
+	for _, args := range w.rows {
+		batch.Entries = append(batch.Entries, gocql.BatchEntry{
+			Stmt:       w.statement,
+			Args:       args,
+			Idempotent: true,
+		})
+	}
+
+	return client.session.ExecuteBatch(batch.WithContext(ctx))
+}
+
+func maxInFlight(client *DatabaseClient) int {
+	if client.config.MaxInFlight > 0 {
+		return client.config.MaxInFlight
+	}
+
+	return defaultMaxInFlight
+}
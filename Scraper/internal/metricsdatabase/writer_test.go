@@ -0,0 +1,92 @@
+package metricsdatabase
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartitionKeyColumns(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      int
+	}{
+		{"INSERT INTO base_data.issues (adapter, repository_id, id) VALUES (?,?,?)", 2},
+		{"insert into base_data.changes (adapter, repository_id, entity, item_id) VALUES (?,?,?,?)", 4},
+		{"DELETE FROM base_data.repositories_by_grouping_key WHERE adapter = ? AND grouping_key = ? AND id = ?", 2},
+		{"INSERT INTO repositories_by_adapter (adapter, id) VALUES (?,?)", 1},
+		{"INSERT INTO base_data.unknown (a, b) VALUES (?,?)", 0},
+		{"UPDATE base_data.issues SET title = ? WHERE adapter = ? AND repository_id = ? AND id = ?", 0},
+	}
+
+	for _, test := range tests {
+		if got := partitionKeyColumns(test.statement); got != test.want {
+			t.Errorf("partitionKeyColumns(%q) = %d, want %d", test.statement, got, test.want)
+		}
+	}
+}
+
+func TestBatchesByPartition(t *testing.T) {
+	insert := "INSERT INTO base_data.issues (adapter, repository_id, id) VALUES (?,?,?)"
+	update := "UPDATE base_data.issues SET title = ? WHERE adapter = ? AND repository_id = ? AND id = ?"
+
+	tests := []struct {
+		name      string
+		statement string
+		values    [][]any
+		want      [][][]any
+	}{
+		{"no rows", insert, nil, nil},
+		{"one partition", insert, [][]any{{"github", "1", "a"}, {"github", "1", "b"}}, [][][]any{
+			{{"github", "1", "a"}, {"github", "1", "b"}},
+		}},
+		{"in order of the first row", insert, [][]any{{"github", "2", "a"}, {"github", "1", "b"}, {"github", "2", "c"}}, [][][]any{
+			{{"github", "2", "a"}, {"github", "2", "c"}},
+			{{"github", "1", "b"}},
+		}},
+		{"adapters", insert, [][]any{{"github", "1", "a"}, {"gitlab", "1", "a"}}, [][][]any{
+			{{"github", "1", "a"}},
+			{{"gitlab", "1", "a"}},
+		}},
+		{"update", update, [][]any{{"a", "github", "1", "1"}, {"b", "github", "1", "2"}}, [][][]any{
+			{{"a", "github", "1", "1"}},
+			{{"b", "github", "1", "2"}},
+		}},
+	}
+
+	for _, test := range tests {
+		var got [][][]any
+		for _, w := range batchesByPartition(test.statement, test.values) {
+			if w.statement != test.statement {
+				t.Errorf("%s: statement = %q, want %q", test.name, w.statement, test.statement)
+			}
+			got = append(got, w.rows)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: batches = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBatchesByPartitionChunks(t *testing.T) {
+	var values [][]any
+	for i := 0; i < chunkSize*2+1; i++ {
+		values = append(values, []any{"github", "1", i})
+	}
+
+	writes := batchesByPartition("INSERT INTO base_data.issues (adapter, repository_id, id) VALUES (?,?,?)", values)
+	if len(writes) != 3 {
+		t.Fatalf("%d rows of one partition were sent in %d batches, want 3", len(values), len(writes))
+	}
+	if len(writes[2].rows) != 1 {
+		t.Errorf("the last batch has %d rows, want 1", len(writes[2].rows))
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	conditional := "INSERT INTO base_data.issues (adapter, repository_id, id) VALUES (?,?,?) IF NOT EXISTS"
+	writes := updates(conditional, [][]any{{"github", "1", "a"}, {"github", "1", "b"}})
+	if len(writes) != 2 {
+		t.Errorf("conditional rows of one partition were sent in %d writes, want 2", len(writes))
+	}
+}
@@ -0,0 +1,100 @@
+package monitoring
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	adapterRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_adapter_requests_total",
+		Help: "Requests sent to adapters.",
+	}, []string{"adapter", "endpoint", "status"})
+
+	adapterRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scraper_adapter_request_duration_seconds",
+		Help:    "Duration of requests sent to adapters until the response headers arrived.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"adapter", "endpoint"})
+
+	itemsFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_items_fetched_total",
+		Help: "Items returned by adapters.",
+	}, []string{"adapter", "entity"})
+
+	batchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scraper_cassandra_batch_duration_seconds",
+		Help:    "Duration of batches executed against Cassandra.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"table"})
+
+	batchFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_cassandra_batch_failures_total",
+		Help: "Batches that Cassandra rejected.",
+	}, []string{"table"})
+
+	aggregationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scraper_aggregation_duration_seconds",
+		Help:    "Duration of calculating and storing the metrics of a repository.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"adapter", "repository"})
+
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scraper_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful scrape or aggregation of a repository.",
+	}, []string{"adapter", "repository", "stage"})
+)
+
+var tablePattern = regexp.MustCompile(`(?i)^\s*(?:INSERT\s+INTO|UPDATE|DELETE\s+FROM)\s+([\w.]+)`)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveAdapterRequest records a request to an adapter. A status of 0 means
+// the request failed before a response was received.
+func ObserveAdapterRequest(adapter string, endpoint string, status int, start time.Time) {
+	statusLabel := "error"
+	if status > 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+
+	adapterRequests.WithLabelValues(adapter, endpoint, statusLabel).Inc()
+	adapterRequestDuration.WithLabelValues(adapter, endpoint).Observe(time.Since(start).Seconds())
+}
+
+func ObserveItemsFetched(adapter string, entity string, count int) {
+	itemsFetched.WithLabelValues(adapter, entity).Add(float64(count))
+}
+
+// ObserveBatch records a batch execution, labelled with the table of its first
+// statement.
+func ObserveBatch(statement string, start time.Time, err error) {
+	table := "unknown"
+	if match := tablePattern.FindStringSubmatch(statement); match != nil {
+		table = match[1]
+	}
+
+	batchDuration.WithLabelValues(table).Observe(time.Since(start).Seconds())
+	if err != nil {
+		batchFailures.WithLabelValues(table).Inc()
+	}
+}
+
+func ObserveAggregation(adapter string, repository string, start time.Time) {
+	aggregationDuration.WithLabelValues(adapter, repository).Observe(time.Since(start).Seconds())
+}
+
+const (
+	StageScrape    = "scrape"
+	StageAggregate = "aggregate"
+)
+
+func MarkSuccess(adapter string, repository string, stage string) {
+	lastSuccess.WithLabelValues(adapter, repository, stage).SetToCurrentTime()
+}
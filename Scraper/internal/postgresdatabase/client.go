@@ -0,0 +1,28 @@
+package postgresdatabase
+
+import (
+	"embed"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"io/fs"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/sqldatabase"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open connects to Postgres and applies all pending migrations. TimescaleDB is
+// used for the deployment frequencies if the extension is available.
+func Open(config internal.PostgresConfig) *sqldatabase.Store {
+	files, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	return sqldatabase.Open(sqldatabase.Dialect{
+		Name:       "postgres",
+		Driver:     "pgx",
+		Rebind:     sqldatabase.DollarNumbers,
+		Migrations: files,
+	}, config.Dsn)
+}
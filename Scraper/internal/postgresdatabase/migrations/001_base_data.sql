@@ -0,0 +1,123 @@
+create table if not exists repositories
+(
+    adapter            TEXT NOT NULL,
+    id                 TEXT NOT NULL,
+    full_name          TEXT,
+    default_branch     TEXT,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    grouping_key       TEXT,
+    manually_corrected BOOLEAN,
+    primary key (adapter, id)
+);
+
+
+create table if not exists issues
+(
+    adapter            TEXT NOT NULL,
+    repository_id      TEXT NOT NULL,
+    id                 TEXT NOT NULL,
+    type               TEXT,
+    closed_at          TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ,
+    pull_request_ids   JSONB,
+    manually_corrected BOOLEAN,
+    primary key (adapter, repository_id, id)
+);
+
+
+create table if not exists commits
+(
+    adapter            TEXT NOT NULL,
+    repository_id      TEXT NOT NULL,
+    id                 TEXT NOT NULL,
+    created_at         TIMESTAMPTZ,
+    manually_corrected BOOLEAN,
+    primary key (adapter, repository_id, id)
+);
+
+
+create table if not exists pull_requests
+(
+    adapter            TEXT NOT NULL,
+    repository_id      TEXT NOT NULL,
+    id                 TEXT NOT NULL,
+    head               JSONB,
+    base               JSONB,
+    issue_ids          JSONB,
+    commit_ids         JSONB,
+    closed_at          TIMESTAMPTZ,
+    merged_at          TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ,
+    manually_corrected BOOLEAN,
+    primary key (adapter, repository_id, id)
+);
+
+
+create table if not exists deployments
+(
+    adapter            TEXT NOT NULL,
+    repository_id      TEXT NOT NULL,
+    id                 TEXT NOT NULL,
+    sha                TEXT,
+    commit_id          TEXT,
+    ref                TEXT,
+    task               TEXT,
+    environment_id     TEXT,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    manually_corrected BOOLEAN,
+    primary key (adapter, repository_id, id)
+);
+
+
+create table if not exists environments
+(
+    adapter            TEXT NOT NULL,
+    repository_id      TEXT NOT NULL,
+    id                 TEXT NOT NULL,
+    name               TEXT,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    manually_corrected BOOLEAN,
+    primary key (adapter, repository_id, id)
+);
+
+
+create table if not exists leases
+(
+    name        TEXT NOT NULL,
+    owner       TEXT NOT NULL,
+    acquired_at TIMESTAMPTZ,
+    expires_at  BIGINT NOT NULL,
+    primary key (name)
+);
+
+
+create table if not exists scraper_instances
+(
+    id           TEXT NOT NULL,
+    started_at   TIMESTAMPTZ,
+    heartbeat_at TIMESTAMPTZ,
+    expires_at   BIGINT NOT NULL,
+    primary key (id)
+);
+
+
+create table if not exists scrape_runs
+(
+    adapter         TEXT NOT NULL,
+    repository_id   TEXT NOT NULL,
+    stage           TEXT NOT NULL,
+    started_at      TIMESTAMPTZ NOT NULL,
+    run_id          TEXT NOT NULL,
+    finished_at     TIMESTAMPTZ,
+    status          TEXT,
+    counts          JSONB,
+    errors          JSONB,
+    instance        TEXT,
+    scraper_version TEXT,
+    primary key (adapter, repository_id, stage, started_at, run_id)
+);
+
+create index if not exists scrape_runs_started_at on scrape_runs (started_at desc);
@@ -0,0 +1,17 @@
+-- Deployment frequencies become a hypertable when TimescaleDB is installed on
+-- the server. Plain Postgres keeps the regular table. An extension that is
+-- available but can't be loaded, e.g. because it is missing from
+-- shared_preload_libraries, also keeps the regular table.
+do
+$$
+begin
+    if exists(select 1 from pg_available_extensions where name = 'timescaledb') then
+        begin
+            create extension if not exists timescaledb;
+            perform create_hypertable('deployment_frequencies', 'date', if_not_exists => true, migrate_data => true);
+        exception when others then
+            raise notice 'TimescaleDB is not used: %', sqlerrm;
+        end;
+    end if;
+end
+$$;
@@ -0,0 +1,5 @@
+-- Items that vanished upstream are tombstoned instead of being kept forever
+alter table issues add column deleted_at TIMESTAMPTZ;
+alter table pull_requests add column deleted_at TIMESTAMPTZ;
+alter table deployments add column deleted_at TIMESTAMPTZ;
+alter table environments add column deleted_at TIMESTAMPTZ;
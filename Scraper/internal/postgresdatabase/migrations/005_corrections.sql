@@ -0,0 +1,12 @@
+-- Every manual correction, so it is known who changed what
+create table if not exists corrections
+(
+    adapter       TEXT NOT NULL,
+    repository_id TEXT NOT NULL,
+    corrected_at  TIMESTAMPTZ NOT NULL,
+    entity        TEXT NOT NULL,
+    id            TEXT NOT NULL,
+    fields        JSONB,
+    author        TEXT,
+    primary key (adapter, repository_id, corrected_at, entity, id)
+);
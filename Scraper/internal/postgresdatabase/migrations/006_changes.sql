@@ -0,0 +1,14 @@
+-- The history of the fields of every item
+create table if not exists changes
+(
+    adapter       TEXT NOT NULL,
+    repository_id TEXT NOT NULL,
+    entity        TEXT NOT NULL,
+    id            TEXT NOT NULL,
+    changed_at    TIMESTAMPTZ NOT NULL,
+    field         TEXT NOT NULL,
+    old_value     TEXT,
+    new_value     TEXT,
+    source        TEXT,
+    primary key (adapter, repository_id, entity, id, changed_at, field)
+);
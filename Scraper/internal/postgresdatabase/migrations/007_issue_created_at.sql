@@ -0,0 +1,3 @@
+-- The retention of the metrics per issue is measured from the creation of the issue
+alter table lead_times add column issue_created_at TIMESTAMPTZ;
+alter table times_to_restore_service add column issue_created_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+-- The repository of the issue, so the metrics of deleted issues can be removed
+alter table lead_times add column issue_repository_id TEXT;
+alter table times_to_restore_service add column issue_repository_id TEXT;
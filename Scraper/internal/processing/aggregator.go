@@ -1,50 +1,128 @@
 package processing
 
 import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
 	"thesis/scraper/internal"
-	"thesis/scraper/internal/metricsdatabase"
+	"thesis/scraper/internal/monitoring"
+	"thesis/scraper/internal/sharding"
+	"thesis/scraper/internal/storage"
+	"thesis/scraper/internal/tracing"
 	"time"
 )
 
 type void struct{}
 
-func Aggregate(adapter internal.Adapter, metricsClient *metricsdatabase.DatabaseClient) {
-	for _, repo := range loadRepos(adapter, metricsClient) {
-		var issues []internal.Issue
-		var commits []internal.Commit
-		var pullRequests []internal.PullRequest
-		var deployments []internal.Deployment
-		var environments []internal.Environment
+func Aggregate(ctx context.Context, runId string, adapter internal.Adapter, scraper internal.ScraperConfig, membership *sharding.Membership, logger *slog.Logger, store storage.Store) {
+	repos, err := loadRepos(ctx, adapter, store)
+	if err != nil {
+		logger.Error("Could not list the repositories to aggregate", "adapter", adapter.Name, internal.ErrorAttr(err))
+		return
+	}
+
+	for _, repo := range repos {
+		if !sharding.Owns(membership, adapter.Name, repo.Id) {
+			continue
+		}
+
+		AggregateRepository(ctx, runId, adapter, repo, scraper, logger, store)
+	}
+}
+
+// AggregateRepository recalculates the metrics of a single repository from the
+// stored base data, unless another instance is already aggregating it.
+func AggregateRepository(ctx context.Context, runId string, adapter internal.Adapter, repo internal.Repository, scraper internal.ScraperConfig, logger *slog.Logger, store storage.Store) {
+	repoLogger := logger.With("adapter", adapter.Name, "repository", repo.Id)
+
+	lease := storage.AcquireLease(store, "aggregations/"+sharding.Key(adapter.Name, repo.Id), scraper.Instance, scraper.LeaseDuration)
+	if lease == nil {
+		repoLogger.Info("Skipping aggregation, it is processed by another instance")
+		return
+	}
+	defer storage.ReleaseLease(store, lease)
+
+	var issues []internal.Issue
+	var commits []internal.Commit
+	var pullRequests []internal.PullRequest
+	var deployments []internal.Deployment
+	var environments []internal.Environment
+
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "Aggregate")
+	defer span.End()
+	span.SetAttributes(attribute.String("adapter", adapter.Name), attribute.String("repository", repo.Id))
+
+	run := startRun(ctx, runId, internal.RunStageAggregate, adapter, repo.Id, scraper, store)
 
-		loadData(adapter, repo, metricsClient, &issues, &commits, &pullRequests, &deployments, &environments)
-		aggregate(repo, issues, commits, pullRequests, deployments, environments, adapter, metricsClient)
+	// The run is recorded with ctx, so it is still finished if the lease is lost
+	work, cancel := storage.WithLease(ctx, lease)
+	defer cancel()
+
+	if err := loadData(work, adapter, repo, store, &issues, &commits, &pullRequests, &deployments, &environments); err != nil {
+		failRun(ctx, run, err, store)
+		repoLogger.Error("Could not load the base data to aggregate", internal.ErrorAttr(err))
+		return
+	}
+	run.Counts["issues"] = len(issues)
+	run.Counts["commits"] = len(commits)
+	run.Counts["pull_requests"] = len(pullRequests)
+	run.Counts["deployments"] = len(deployments)
+	run.Counts["environments"] = len(environments)
+
+	failures := aggregate(work, repo, issues, commits, pullRequests, deployments, environments, adapter, store)
+	if errors.Is(context.Cause(work), storage.ErrLeaseLost) {
+		repoLogger.Warn("Lost the lease of the aggregation, the remaining writes were cancelled")
+	}
+	finishRun(ctx, run, failures, store)
+	monitoring.ObserveAggregation(adapter.Name, repo.Id, start)
+	if len(failures) == 0 {
+		monitoring.MarkSuccess(adapter.Name, repo.Id, monitoring.StageAggregate)
 	}
+	repoLogger.Info("Aggregated repository",
+		"issues", len(issues),
+		"pull_requests", len(pullRequests),
+		"deployments", len(deployments),
+		"duration", time.Since(start))
 }
 
-func loadRepos(adapter internal.Adapter, metricsClient *metricsdatabase.DatabaseClient) (repos []internal.Repository) {
-	return metricsdatabase.ListRepositories(adapter, metricsClient)
+func loadRepos(ctx context.Context, adapter internal.Adapter, store storage.Store) ([]internal.Repository, error) {
+	return store.ListRepositories(ctx, adapter)
 }
 
-func loadData(adapter internal.Adapter, repo internal.Repository, metricsClient *metricsdatabase.DatabaseClient, issues *[]internal.Issue, commits *[]internal.Commit, pullRequests *[]internal.PullRequest, deployments *[]internal.Deployment, environments *[]internal.Environment) {
-	*issues = append(*issues, metricsdatabase.ListIssues(adapter, metricsClient, repo)...)
-	*commits = append(*commits, metricsdatabase.ListCommits(adapter, metricsClient, repo)...)
-	*pullRequests = append(*pullRequests, metricsdatabase.ListPullRequests(adapter, metricsClient, repo)...)
-	*deployments = append(*deployments, metricsdatabase.ListDeployments(adapter, metricsClient, repo)...)
-	*environments = append(*environments, metricsdatabase.ListEnvironments(adapter, metricsClient, repo)...)
+// loadData reads the base data of a repository. Metrics calculated from
+// partially read data would replace the correct ones, so it stops on an error.
+func loadData(ctx context.Context, adapter internal.Adapter, repo internal.Repository, store storage.Store, issues *[]internal.Issue, commits *[]internal.Commit, pullRequests *[]internal.PullRequest, deployments *[]internal.Deployment, environments *[]internal.Environment) (err error) {
+	if *issues, err = store.ListIssues(ctx, adapter, repo); err != nil {
+		return
+	}
+	if *commits, err = store.ListCommits(ctx, adapter, repo); err != nil {
+		return
+	}
+	if *pullRequests, err = store.ListPullRequests(ctx, adapter, repo); err != nil {
+		return
+	}
+	if *deployments, err = store.ListDeployments(ctx, adapter, repo); err != nil {
+		return
+	}
+	*environments, err = store.ListEnvironments(ctx, adapter, repo)
+
+	return
 }
 
-func aggregate(repo internal.Repository, issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest, deployments []internal.Deployment, environments []internal.Environment, adapter internal.Adapter, metricsClient *metricsdatabase.DatabaseClient) {
-	deploymentFrequency := calculateDeploymentFrequency(deployments)
-	metricsdatabase.InsertDeploymentFrequency(adapter, repo, deploymentFrequency, metricsClient)
+func aggregate(ctx context.Context, repo internal.Repository, issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest, deployments []internal.Deployment, environments []internal.Environment, adapter internal.Adapter, store storage.Store) (failures []storage.RowError) {
+	deploymentFrequency := calculateDeploymentFrequency(ctx, deployments)
+	failures = append(failures, store.InsertDeploymentFrequency(ctx, adapter, repo, deploymentFrequency)...)
 
-	leadTimes := calculateLeadTimeForChange(issues)
-	metricsdatabase.InsertLeadTimeForChange(adapter, repo, leadTimes, metricsClient)
+	leadTimes := calculateLeadTimeForChange(ctx, issues)
+	failures = append(failures, store.InsertLeadTimeForChange(ctx, adapter, repo, leadTimes)...)
 
-	changeFailureRate := calculateChangeFailureRate(issues)
-	metricsdatabase.InsertChangeFailureRate(adapter, repo, changeFailureRate, metricsClient)
+	changeFailureRate := calculateChangeFailureRate(ctx, issues)
+	failures = append(failures, store.InsertChangeFailureRate(ctx, adapter, repo, changeFailureRate)...)
 
-	timesToRestoreService := calculateTimesToRestoreService(issues)
-	metricsdatabase.InsertTimesToRestoreService(adapter, repo, timesToRestoreService, metricsClient)
+	timesToRestoreService := calculateTimesToRestoreService(ctx, issues)
+	failures = append(failures, store.InsertTimesToRestoreService(ctx, adapter, repo, timesToRestoreService)...)
 	/*
 		backtrackedCommits := backtrackCommits(pullRequests)
 		tbl := table.New("Ref", "Commit", "Timestamp")
@@ -57,9 +135,13 @@ func aggregate(repo internal.Repository, issues []internal.Issue, commits []inte
 		tbl.Print()
 	*/
 
+	return
 }
 
-func calculateDeploymentFrequency(deployments []internal.Deployment) (deploymentCounts map[string]int) {
+func calculateDeploymentFrequency(ctx context.Context, deployments []internal.Deployment) (deploymentCounts map[string]int) {
+	_, span := tracing.Start(ctx, "calculateDeploymentFrequency")
+	defer span.End()
+
 	deploymentCounts = make(map[string]int)
 
 	var minDate time.Time
@@ -108,8 +190,11 @@ func calculateDeploymentFrequency(deployments []internal.Deployment) (deployment
 	return deploymentCounts
 }
 
-func calculateLeadTimeForChange(issues []internal.Issue) (leadTimes map[string]time.Duration) {
-	leadTimes = make(map[string]time.Duration)
+func calculateLeadTimeForChange(ctx context.Context, issues []internal.Issue) (leadTimes map[string]internal.IssueDuration) {
+	_, span := tracing.Start(ctx, "calculateLeadTimeForChange")
+	defer span.End()
+
+	leadTimes = make(map[string]internal.IssueDuration)
 
 	for _, issue := range issues {
 		if issue.Type == nil || *issue.Type == "Issue" {
@@ -119,14 +204,17 @@ func calculateLeadTimeForChange(issues []internal.Issue) (leadTimes map[string]t
 				baseDate = *issue.ClosedAt
 			}
 
-			leadTimes[issue.ID] = baseDate.Sub(issue.CreatedAt)
+			leadTimes[issue.ID] = internal.IssueDuration{Duration: baseDate.Sub(issue.CreatedAt), CreatedAt: issue.CreatedAt}
 		}
 	}
 
 	return leadTimes
 }
 
-func calculateChangeFailureRate(issues []internal.Issue) float64 {
+func calculateChangeFailureRate(ctx context.Context, issues []internal.Issue) float64 {
+	_, span := tracing.Start(ctx, "calculateChangeFailureRate")
+	defer span.End()
+
 	var issueCount int = 0
 	var failureCount int = 0
 
@@ -147,8 +235,11 @@ func calculateChangeFailureRate(issues []internal.Issue) float64 {
 	return float64(failureCount) / float64(issueCount)
 }
 
-func calculateTimesToRestoreService(issues []internal.Issue) (timesToRestoreService map[string]time.Duration) {
-	timesToRestoreService = make(map[string]time.Duration)
+func calculateTimesToRestoreService(ctx context.Context, issues []internal.Issue) (timesToRestoreService map[string]internal.IssueDuration) {
+	_, span := tracing.Start(ctx, "calculateTimesToRestoreService")
+	defer span.End()
+
+	timesToRestoreService = make(map[string]internal.IssueDuration)
 
 	for _, issue := range issues {
 		if issue.Type != nil && *issue.Type == "Bug" {
@@ -158,7 +249,7 @@ func calculateTimesToRestoreService(issues []internal.Issue) (timesToRestoreServ
 				baseDate = *issue.ClosedAt
 			}
 
-			timesToRestoreService[issue.ID] = baseDate.Sub(issue.CreatedAt)
+			timesToRestoreService[issue.ID] = internal.IssueDuration{Duration: baseDate.Sub(issue.CreatedAt), CreatedAt: issue.CreatedAt}
 		}
 	}
 
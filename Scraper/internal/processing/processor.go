@@ -1,22 +1,119 @@
 package processing
 
 import (
-	"sync"
+	"context"
+	"log/slog"
 	"thesis/scraper/internal"
-	"thesis/scraper/internal/metricsdatabase"
+	"thesis/scraper/internal/history"
+	"thesis/scraper/internal/storage"
+	"thesis/scraper/internal/tracing"
+	"time"
 )
 
-func Process(issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest, deployments []internal.Deployment, environments []internal.Environment, adapter internal.Adapter, metricsClient *metricsdatabase.DatabaseClient, group *sync.WaitGroup) {
-	defer group.Done()
+// Process stores the fetched items and returns the rows that could not be
+// written.
+func Process(ctx context.Context, issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest, deployments []internal.Deployment, environments []internal.Environment, adapter internal.Adapter, store storage.Store) []storage.RowError {
+	ctx, span := tracing.Start(ctx, "Process")
+	defer span.End()
 
 	repo := findRepo(issues, commits, pullRequests)
 
-	metricsdatabase.InsertRepository(adapter, *repo, metricsClient)
-	metricsdatabase.InsertIssues(adapter, *repo, issues, metricsClient)
-	metricsdatabase.InsertCommits(adapter, *repo, commits, metricsClient)
-	metricsdatabase.InsertPullRequests(adapter, *repo, pullRequests, metricsClient)
-	metricsdatabase.InsertDeployments(adapter, *repo, deployments, metricsClient)
-	metricsdatabase.InsertEnvironments(adapter, *repo, environments, metricsClient)
+	failures := Upsert(ctx, adapter, *repo, issues, commits, pullRequests, deployments, environments, history.SourceScrape, store)
+
+	failures = append(failures, markVanished(ctx, adapter, *repo, storage.EntityIssues, ids(issues), store)...)
+	failures = append(failures, markVanished(ctx, adapter, *repo, storage.EntityPullRequests, ids(pullRequests), store)...)
+	failures = append(failures, markVanished(ctx, adapter, *repo, storage.EntityDeployments, ids(deployments), store)...)
+	failures = append(failures, markVanished(ctx, adapter, *repo, storage.EntityEnvironments, ids(environments), store)...)
+
+	return failures
+}
+
+// Upsert inserts or updates the repository and its items and records the
+// changes of their fields, which the store returns for the rows it overwrote,
+// with the given source. It returns the rows that could not be written.
+func Upsert(ctx context.Context, adapter internal.Adapter, repo internal.Repository, issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest, deployments []internal.Deployment, environments []internal.Environment, source string, store storage.Store) []storage.RowError {
+	changes, failures := store.InsertRepository(ctx, adapter, repo)
+	itemChanges, itemFailures := insertItems(ctx, adapter, repo, issues, commits, pullRequests, deployments, environments, store)
+
+	failures = append(failures, itemFailures...)
+	return append(failures, recordChanges(ctx, append(changes, itemChanges...), source, store)...)
+}
+
+// UpsertItems is Upsert for the items of a repository that is already stored,
+// which is left as it is.
+func UpsertItems(ctx context.Context, adapter internal.Adapter, repo internal.Repository, issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest, deployments []internal.Deployment, environments []internal.Environment, source string, store storage.Store) []storage.RowError {
+	changes, failures := insertItems(ctx, adapter, repo, issues, commits, pullRequests, deployments, environments, store)
+
+	return append(failures, recordChanges(ctx, changes, source, store)...)
+}
+
+func insertItems(ctx context.Context, adapter internal.Adapter, repo internal.Repository, issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest, deployments []internal.Deployment, environments []internal.Environment, store storage.Store) (changes []internal.Change, failures []storage.RowError) {
+	collect := func(written []internal.Change, failed []storage.RowError) {
+		changes = append(changes, written...)
+		failures = append(failures, failed...)
+	}
+
+	collect(store.InsertIssues(ctx, adapter, repo, issues))
+	collect(nil, store.InsertCommits(ctx, adapter, repo, commits))
+	collect(store.InsertPullRequests(ctx, adapter, repo, pullRequests))
+	collect(store.InsertDeployments(ctx, adapter, repo, deployments))
+	collect(store.InsertEnvironments(ctx, adapter, repo, environments))
+
+	return
+}
+
+// recordChanges stores the changes with their source and the current time.
+func recordChanges(ctx context.Context, changes []internal.Change, source string, store storage.Store) []storage.RowError {
+	changedAt := time.Now()
+	for i := range changes {
+		changes[i].Source = source
+		changes[i].ChangedAt = changedAt
+	}
+
+	return store.InsertChanges(ctx, changes)
+}
+
+// markVanished tombstones the stored items the adapter no longer returns. An
+// empty response is more likely a problem of the adapter than every item
+// being deleted, so it never deletes anything. Neither does it if the stored
+// items can't be read.
+func markVanished(ctx context.Context, adapter internal.Adapter, repo internal.Repository, entity string, fetched []string, store storage.Store) []storage.RowError {
+	if len(fetched) == 0 {
+		return nil
+	}
+
+	existing := make(map[string]bool)
+	for _, id := range fetched {
+		existing[id] = true
+	}
+
+	stored, err := store.ListIds(ctx, adapter, repo, entity)
+	if err != nil {
+		slog.Warn("Could not list the stored items to find vanished ones", "adapter", adapter.Name, "repository", repo.Id, "entity", entity, internal.ErrorAttr(err))
+		return nil
+	}
+
+	var vanished []string
+	for _, id := range stored {
+		if !existing[id] {
+			vanished = append(vanished, id)
+		}
+	}
+
+	if len(vanished) == 0 {
+		return nil
+	}
+
+	slog.Info("Marking vanished items as deleted", "adapter", adapter.Name, "repository", repo.Id, "entity", entity, "count", len(vanished))
+	return store.MarkDeleted(ctx, adapter, repo, entity, vanished, time.Now())
+}
+
+func ids[T any](items []T) (ids []string) {
+	for _, item := range items {
+		ids = append(ids, history.Id(item))
+	}
+
+	return
 }
 
 func findRepo(issues []internal.Issue, commits []internal.Commit, pullRequests []internal.PullRequest) (repo *internal.Repository) {
@@ -0,0 +1,97 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// maxRunErrors limits the failed rows recorded in a run, the rest are counted.
+const maxRunErrors = 20
+
+var activeRuns = make(map[*internal.ScrapeRun]storage.RunStore)
+var activeRunsMutex sync.Mutex
+var registerRunHook sync.Once
+
+// startRun records that a stage of a run started for a repository. Runs that
+// are still active when the scraper exits on a fatal error are marked failed.
+func startRun(ctx context.Context, runId string, stage string, adapter internal.Adapter, repositoryId string, scraper internal.ScraperConfig, store storage.Store) *internal.ScrapeRun {
+	registerRunHook.Do(func() {
+		internal.OnFatal(failActiveRuns)
+	})
+
+	run := &internal.ScrapeRun{
+		RunId:          runId,
+		Adapter:        adapter.Name,
+		RepositoryId:   repositoryId,
+		Stage:          stage,
+		StartedAt:      time.Now(),
+		Status:         internal.RunStatusRunning,
+		Counts:         make(map[string]int),
+		Instance:       scraper.Instance,
+		ScraperVersion: internal.Version,
+	}
+
+	store.InsertScrapeRun(ctx, *run)
+
+	activeRunsMutex.Lock()
+	activeRuns[run] = store
+	activeRunsMutex.Unlock()
+
+	return run
+}
+
+// finishRun records that a stage of a run finished. A run that could not write
+// some of its rows is partial, with the first of them as its errors.
+func finishRun(ctx context.Context, run *internal.ScrapeRun, failures []storage.RowError, store storage.Store) {
+	activeRunsMutex.Lock()
+	delete(activeRuns, run)
+	activeRunsMutex.Unlock()
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = internal.RunStatusSucceeded
+
+	if len(failures) > 0 {
+		run.Status = internal.RunStatusPartial
+		for _, failure := range failures[:min(len(failures), maxRunErrors)] {
+			run.Errors = append(run.Errors, failure.Error())
+		}
+		if len(failures) > maxRunErrors {
+			run.Errors = append(run.Errors, fmt.Sprintf("%d more rows could not be written", len(failures)-maxRunErrors))
+		}
+	}
+
+	store.InsertScrapeRun(ctx, *run)
+}
+
+// failRun records that a stage of a run stopped on an error.
+func failRun(ctx context.Context, run *internal.ScrapeRun, err error, store storage.Store) {
+	activeRunsMutex.Lock()
+	delete(activeRuns, run)
+	activeRunsMutex.Unlock()
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = internal.RunStatusFailed
+	run.Errors = append(run.Errors, err.Error())
+
+	store.InsertScrapeRun(ctx, *run)
+}
+
+func failActiveRuns(err error) {
+	activeRunsMutex.Lock()
+	defer activeRunsMutex.Unlock()
+
+	finishedAt := time.Now()
+	for run, store := range activeRuns {
+		run.FinishedAt = &finishedAt
+		run.Status = internal.RunStatusFailed
+		run.Errors = append(run.Errors, err.Error())
+
+		store.InsertScrapeRun(context.Background(), *run)
+	}
+}
@@ -1,130 +1,167 @@
 package processing
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
 	"io"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
 	"thesis/scraper/internal"
 	"thesis/scraper/internal/basedatabase"
-	"thesis/scraper/internal/metricsdatabase"
+	"thesis/scraper/internal/monitoring"
+	"thesis/scraper/internal/sharding"
+	"thesis/scraper/internal/storage"
+	"thesis/scraper/internal/tracing"
+	"time"
 )
 
-//var chunkSize = 20000
+func HandleRepository(ctx context.Context, runId string, repository internal.ConfigRepository, adapter internal.Adapter, scraper internal.ScraperConfig, logger *slog.Logger, client *basedatabase.DatabaseClient, store storage.Store, group *sync.WaitGroup) {
+	logger = logger.With("adapter", adapter.Name, "repository", repository.Id)
 
-func HandleRepository(repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, metricsClient *metricsdatabase.DatabaseClient, group *sync.WaitGroup) {
-	var issues []internal.Issue
-	var commits []internal.Commit
-	var pullRequests []internal.PullRequest
-	var deployments []internal.Deployment
-	var environments []internal.Environment
+	lease := storage.AcquireLease(store, "repositories/"+sharding.Key(adapter.Name, repository.Id), scraper.Instance, scraper.LeaseDuration)
+	if lease == nil {
+		logger.Info("Skipping repository, it is processed by another instance")
+		return
+	}
 
-	requestIssues(repository, adapter, client, &issues)
-	requestCommits(repository, adapter, client, &commits)
-	requestPullRequests(repository, adapter, client, &pullRequests)
-	requestDeployments(repository, adapter, client, &deployments)
-	requestEnvironments(repository, adapter, client, &environments)
+	logger.Info("Processing repository")
 
-	group.Add(1)
-	go Process(issues, commits, pullRequests, deployments, environments, adapter, metricsClient, group)
-}
+	ctx, span := tracing.Start(ctx, "HandleRepository")
+	span.SetAttributes(attribute.String("adapter", adapter.Name), attribute.String("repository", repository.Id))
 
-func requestPullRequests(repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, pullRequests *[]internal.PullRequest) {
-	pullRequests = request(adapter, fmt.Sprintf("direct/repos/%s/pulls", repository.Id), pullRequests)
+	run := startRun(ctx, runId, internal.RunStageScrape, adapter, repository.Id, scraper, store)
 
-	/*
-		if (pullRequests != nil) && (len(*pullRequests) > 0) {
-			for _, pullRequest := range *pullRequests {
-				jsonValue, _ := json.Marshal(pullRequest)
-				go basedatabase.InsertJson(client, "INSERT INTO pull_requests VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `json` = ?", pullRequest.Repo.Id, pullRequest.ID, string(jsonValue), string(jsonValue))
-			}
-		}
-	*/
-}
+	// The run is recorded with ctx, so it is still finished if the lease is lost
+	work, cancel := storage.WithLease(ctx, lease)
 
-func requestIssues(repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, issues *[]internal.Issue) {
-	issues = request(adapter, fmt.Sprintf("direct/repos/%s/issues", repository.Id), issues)
+	var issues []internal.Issue
+	var commits []internal.Commit
+	var pullRequests []internal.PullRequest
+	var deployments []internal.Deployment
+	var environments []internal.Environment
 
-	/*
-		if (issues != nil) && (len(*issues) > 0) {
-			var chunks [][]internal.Issue
+	start := time.Now()
+	requestIssues(work, repository, adapter, client, &issues)
+	recordFetched(logger, adapter, run, "issues", len(issues), start)
 
-			for i := 0; i < len(*issues); i += chunkSize {
-				end := i + chunkSize
+	start = time.Now()
+	requestCommits(work, repository, adapter, client, &commits)
+	recordFetched(logger, adapter, run, "commits", len(commits), start)
 
-				if end > len(*issues) {
-					end = len(*issues)
-				}
+	start = time.Now()
+	requestPullRequests(work, repository, adapter, client, &pullRequests)
+	recordFetched(logger, adapter, run, "pull_requests", len(pullRequests), start)
 
-				chunks = append(chunks, (*issues)[i:end])
-			}
+	start = time.Now()
+	requestDeployments(work, repository, adapter, client, &deployments)
+	recordFetched(logger, adapter, run, "deployments", len(deployments), start)
 
-				for _, chunk := range chunks {
-					var valuesPlaceholder = ""
-					var values []any
+	start = time.Now()
+	requestEnvironments(work, repository, adapter, client, &environments)
+	recordFetched(logger, adapter, run, "environments", len(environments), start)
 
-					for i, issue := range chunk {
-						if i > 0 {
-							valuesPlaceholder += ","
-						}
-						valuesPlaceholder += "(?,?,?)"
+	group.Add(1)
+	go func() {
+		defer group.Done()
+		defer storage.ReleaseLease(store, lease)
+		defer cancel()
+		defer span.End()
+
+		start := time.Now()
+		failures := Process(work, issues, commits, pullRequests, deployments, environments, adapter, store)
+		if errors.Is(context.Cause(work), storage.ErrLeaseLost) {
+			logger.Warn("Lost the lease of the repository, the remaining writes were cancelled")
+		}
+		finishRun(ctx, run, failures, store)
+		if len(failures) == 0 {
+			monitoring.MarkSuccess(adapter.Name, repository.Id, monitoring.StageScrape)
+		}
+		logger.Info("Stored repository", "duration", time.Since(start))
+	}()
+}
 
-						jsonValue, _ := json.Marshal(issue)
-						values = append(values, issue.Repo.Id, issue.ID, string(jsonValue))
-					}
+func recordFetched(logger *slog.Logger, adapter internal.Adapter, run *internal.ScrapeRun, entity string, count int, start time.Time) {
+	run.Counts[entity] = count
+	monitoring.ObserveItemsFetched(adapter.Name, entity, count)
+	logger.Debug("Fetched items", "entity", entity, "count", count, "duration", time.Since(start))
+}
 
-					statement := fmt.Sprintf("INSERT INTO issues (`repo`, `id`, `json`) VALUES %s ON DUPLICATE KEY UPDATE `json` = VALUES(`json`)", valuesPlaceholder)
-					go basedatabase.InsertJson(client, statement, values...)
-				}
-		}
-	*/
+func requestPullRequests(ctx context.Context, repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, pullRequests *[]internal.PullRequest) {
+	payloads := request(ctx, adapter, "direct/repos/{repo_id}/pulls", repository.Id, pullRequests)
+	archive(ctx, repository, adapter, client, "pull_requests", payloads, func(index int) string {
+		return (*pullRequests)[index].ID
+	})
 }
 
-func requestCommits(repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, commits *[]internal.Commit) {
-	commits = request(adapter, fmt.Sprintf("direct/repos/%s/commits", repository.Id), commits)
+func requestIssues(ctx context.Context, repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, issues *[]internal.Issue) {
+	payloads := request(ctx, adapter, "direct/repos/{repo_id}/issues", repository.Id, issues)
+	archive(ctx, repository, adapter, client, "issues", payloads, func(index int) string {
+		return (*issues)[index].ID
+	})
+}
 
-	/*
-		if (commits != nil) && (len(*commits) > 0) {
-			for _, commit := range *commits {
-				jsonValue, _ := json.Marshal(commit)
-				go basedatabase.InsertJson(client, "INSERT INTO commits VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `json` = ?", commit.Repo.Id, commit.Sha, string(jsonValue), string(jsonValue))
-			}
-		}
-	*/
+func requestCommits(ctx context.Context, repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, commits *[]internal.Commit) {
+	payloads := request(ctx, adapter, "direct/repos/{repo_id}/commits", repository.Id, commits)
+	archive(ctx, repository, adapter, client, "commits", payloads, func(index int) string {
+		return (*commits)[index].Sha
+	})
 }
 
-func requestDeployments(repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, deployments *[]internal.Deployment) {
-	deployments = request(adapter, fmt.Sprintf("direct/repos/%s/deployments", repository.Id), deployments)
+func requestDeployments(ctx context.Context, repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, deployments *[]internal.Deployment) {
+	payloads := request(ctx, adapter, "direct/repos/{repo_id}/deployments", repository.Id, deployments)
+	archive(ctx, repository, adapter, client, "deployments", payloads, func(index int) string {
+		return (*deployments)[index].Id
+	})
+}
 
-	/*
-		if (deployments != nil) && (len(*deployments) > 0) {
-			for _, deployment := range *deployments {
-				jsonValue, _ := json.Marshal(deployment)
-				go basedatabase.InsertJson(client, "INSERT IGNORE INTO deployments VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `json` = ?", repository.Id, deployment.Id, string(jsonValue), string(jsonValue))
-			}
-		}
-	*/
+func requestEnvironments(ctx context.Context, repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, environments *[]internal.Environment) {
+	payloads := request(ctx, adapter, "direct/repos/{repo_id}/environments", repository.Id, environments)
+	archive(ctx, repository, adapter, client, "environments", payloads, func(index int) string {
+		return (*environments)[index].Id
+	})
 }
 
-func requestEnvironments(repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, environments *[]internal.Environment) {
-	environments = request(adapter, fmt.Sprintf("direct/repos/%s/environments", repository.Id), environments)
+// archive stores the raw payloads in the base database. A failing archive is
+// logged, but doesn't stop the scrape.
+func archive(ctx context.Context, repository internal.ConfigRepository, adapter internal.Adapter, client *basedatabase.DatabaseClient, entity string, payloads []json.RawMessage, id func(index int) string) {
+	if client == nil || len(payloads) == 0 {
+		return
+	}
 
-	/*
-		if (environments != nil) && (len(*environments) > 0) {
-			for _, environment := range *environments {
-				jsonValue, _ := json.Marshal(environment)
-				go basedatabase.InsertJson(client, "INSERT IGNORE INTO environments VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `json` = ?", repository.Id, environment.Id, string(jsonValue), string(jsonValue))
-			}
-		}
-	*/
+	ctx, span := tracing.Start(ctx, "archive")
+	defer span.End()
+	span.SetAttributes(attribute.String("adapter", adapter.Name), attribute.String("repository", repository.Id), attribute.String("entity", entity))
+
+	fetchedAt := time.Now()
+	var archived []basedatabase.Payload
+	for index, payload := range payloads {
+		archived = append(archived, basedatabase.Payload{
+			Adapter:      adapter.Name,
+			RepositoryId: repository.Id,
+			Entity:       entity,
+			Id:           id(index),
+			FetchedAt:    fetchedAt,
+			Json:         payload,
+		})
+	}
+
+	err := basedatabase.ArchivePayloads(ctx, client, archived)
+	if err != nil {
+		tracing.RecordError(span, err)
+		slog.Warn("Could not archive payloads", "adapter", adapter.Name, "repository", repository.Id, "entity", entity, internal.ErrorAttr(err))
+	}
 }
 
-func request[V any](adapter internal.Adapter, url string, value V) V {
-	res := executeGet(url, adapter)
+// request decodes the response into value and returns the raw payload of every
+// entity in it, in the same order.
+func request[V any](ctx context.Context, adapter internal.Adapter, endpoint string, repositoryId string, value V) (payloads []json.RawMessage) {
+	res := executeGet(ctx, endpoint, strings.Replace(endpoint, "{repo_id}", repositoryId, 1), adapter)
 	if res == nil {
-		return *new(V)
+		return nil
 	}
 
 	if res.Body != nil {
@@ -134,29 +171,45 @@ func request[V any](adapter internal.Adapter, url string, value V) V {
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
 		internal.ProcessError(err)
-		return *new(V)
+		return nil
 	}
 
 	err = json.Unmarshal(body, &value)
 	if err != nil {
 		internal.ProcessError(err)
-		return *new(V)
+		return nil
 	}
 
-	return value
+	err = json.Unmarshal(body, &payloads)
+	if err != nil {
+		internal.ProcessError(err)
+		return nil
+	}
+
+	return payloads
 }
 
-func executeGet(endpoint string, adapter internal.Adapter) (response *http.Response) {
-	req, err := http.NewRequest("GET", buildUrl(adapter.BaseUrl, endpoint), nil)
+func executeGet(ctx context.Context, endpoint string, path string, adapter internal.Adapter) (response *http.Response) {
+	ctx, span := tracing.Start(ctx, "executeGet")
+	defer span.End()
+	span.SetAttributes(attribute.String("adapter", adapter.Name), attribute.String("http.route", endpoint))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", buildUrl(adapter.BaseUrl, path), nil)
 
 	req.Header.Set("Authorization", "Bearer "+adapter.Token)
+	tracing.Inject(ctx, req.Header)
 
+	start := time.Now()
 	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
+		monitoring.ObserveAdapterRequest(adapter.Name, endpoint, 0, start)
+		tracing.RecordError(span, err)
 		internal.ProcessError(err)
 		return
 	}
+	monitoring.ObserveAdapterRequest(adapter.Name, endpoint, res.StatusCode, start)
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
 
 	response = res
 
@@ -0,0 +1,161 @@
+package sharding
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// Membership keeps a scraper instance registered in the database and decides
+// which repositories it is responsible for. Repositories are assigned with
+// rendezvous hashing over the live instances, so only the repositories of an
+// instance that joins or leaves move to a different instance.
+type Membership struct {
+	Instance  string
+	store     storage.CoordinationStore
+	ttl       time.Duration
+	startedAt time.Time
+	members   []string
+	mutex     sync.RWMutex
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func Join(store storage.CoordinationStore, instance string, ttl time.Duration) *Membership {
+	if ttl <= 0 {
+		ttl = storage.DefaultLeaseDuration
+	}
+
+	membership := &Membership{
+		Instance:  instance,
+		store:     store,
+		ttl:       ttl,
+		startedAt: time.Now(),
+		members:   []string{instance},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	store.RegisterInstance(instance, membership.startedAt, ttl)
+	Refresh(membership)
+	go heartbeat(membership)
+
+	return membership
+}
+
+func Leave(membership *Membership) {
+	if membership == nil {
+		return
+	}
+
+	close(membership.stop)
+	<-membership.done
+
+	membership.store.UnregisterInstance(membership.Instance)
+}
+
+// Refresh reloads the live instances. Assignments only change on refresh, so
+// a run keeps a stable view of its repositories. If the instances can't be
+// read, the previous ones are kept, which before the first refresh is only
+// this instance.
+func Refresh(membership *Membership) {
+	if membership == nil {
+		return
+	}
+
+	members, err := membership.store.ListInstances()
+	if err != nil {
+		slog.Warn("Could not list the scraper instances", internal.ErrorAttr(err))
+		return
+	}
+
+	found := false
+	for _, member := range members {
+		if member == membership.Instance {
+			found = true
+			break
+		}
+	}
+	if !found {
+		members = append(members, membership.Instance)
+	}
+	sort.Strings(members)
+
+	membership.mutex.Lock()
+	defer membership.mutex.Unlock()
+
+	if strings.Join(members, ",") != strings.Join(membership.members, ",") {
+		slog.Info("Sharding repositories", "instances", members)
+	}
+	membership.members = members
+}
+
+// Owns reports whether the repository is assigned to this instance. A nil
+// membership owns every repository.
+func Owns(membership *Membership, adapter string, repositoryId string) bool {
+	if membership == nil {
+		return true
+	}
+
+	membership.mutex.RLock()
+	defer membership.mutex.RUnlock()
+
+	return Owner(Key(adapter, repositoryId), membership.members) == membership.Instance
+}
+
+func Key(adapter string, repositoryId string) string {
+	return strings.ToLower(adapter) + "/" + repositoryId
+}
+
+// Owner returns the instance with the highest hash for the key. Instance names
+// often differ in a single character, which FNV alone barely spreads, so the
+// hash is finalized like in MurmurHash3.
+func Owner(key string, instances []string) (owner string) {
+	var highest uint64
+
+	for _, instance := range instances {
+		hash := fnv.New64a()
+		hash.Write([]byte(instance))
+		hash.Write([]byte{0})
+		hash.Write([]byte(key))
+
+		score := mix(hash.Sum64())
+		if owner == "" || score > highest {
+			highest = score
+			owner = instance
+		}
+	}
+
+	return
+}
+
+func mix(hash uint64) uint64 {
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+
+	return hash
+}
+
+func heartbeat(membership *Membership) {
+	defer close(membership.done)
+
+	ticker := time.NewTicker(membership.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-membership.stop:
+			return
+		case <-ticker.C:
+			membership.store.RegisterInstance(membership.Instance, membership.startedAt, membership.ttl)
+		}
+	}
+}
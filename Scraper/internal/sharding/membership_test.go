@@ -0,0 +1,121 @@
+package sharding
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		adapter      string
+		repositoryId string
+		want         string
+	}{
+		{"github", "42", "github/42"},
+		{"GitHub", "42", "github/42"},
+		{"gitlab", "Group/Project", "gitlab/Group/Project"},
+	}
+
+	for _, test := range tests {
+		if got := Key(test.adapter, test.repositoryId); got != test.want {
+			t.Errorf("Key(%q, %q) = %q, want %q", test.adapter, test.repositoryId, got, test.want)
+		}
+	}
+}
+
+func TestOwner(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances []string
+		reordered []string
+	}{
+		{"one instance", []string{"a"}, []string{"a"}},
+		{"two instances", []string{"a", "b"}, []string{"b", "a"}},
+		{"three instances", []string{"a", "b", "c"}, []string{"c", "a", "b"}},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 50; i++ {
+			key := Key("github", fmt.Sprint(i))
+			owner := Owner(key, test.instances)
+			if owner == "" {
+				t.Fatalf("%s: %s has no owner", test.name, key)
+			}
+			if reordered := Owner(key, test.reordered); reordered != owner {
+				t.Errorf("%s: owner of %s depends on the order, %q and %q", test.name, key, owner, reordered)
+			}
+		}
+	}
+
+	if owner := Owner("github/1", nil); owner != "" {
+		t.Errorf("owner without instances = %q, want none", owner)
+	}
+}
+
+// A repository only moves when its owner leaves.
+func TestOwnerIsStable(t *testing.T) {
+	instances := []string{"a", "b", "c"}
+
+	for i := 0; i < 50; i++ {
+		key := Key("github", fmt.Sprint(i))
+		owner := Owner(key, instances)
+
+		for _, leaving := range instances {
+			var remaining []string
+			for _, instance := range instances {
+				if instance != leaving {
+					remaining = append(remaining, instance)
+				}
+			}
+
+			after := Owner(key, remaining)
+			if leaving != owner && after != owner {
+				t.Errorf("%s moved from %q to %q when %q left", key, owner, after, leaving)
+			}
+		}
+	}
+}
+
+// Instances with similar names get a similar share of the repositories.
+func TestOwnerSpreadsEvenly(t *testing.T) {
+	tests := [][]string{
+		{"a", "b"},
+		{"scraper-1", "scraper-2", "scraper-3"},
+		{"host-a:8080", "host-b:8080", "host-c:8080", "host-d:8080"},
+	}
+
+	for _, instances := range tests {
+		counts := make(map[string]int)
+		for i := 0; i < 1000; i++ {
+			counts[Owner(Key("github", fmt.Sprint(i)), instances)]++
+		}
+
+		expected := 1000 / len(instances)
+		for _, instance := range instances {
+			if counts[instance] < expected*3/4 || counts[instance] > expected*5/4 {
+				t.Errorf("%v: %s owns %d of 1000 repositories, want about %d", instances, instance, counts[instance], expected)
+			}
+		}
+	}
+}
+
+func TestOwns(t *testing.T) {
+	if !Owns(nil, "github", "1") {
+		t.Error("a nil membership should own every repository")
+	}
+
+	membership := &Membership{Instance: "a", members: []string{"a", "b"}}
+	owned := 0
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprint(i)
+		if Owns(membership, "github", id) != (Owner(Key("github", id), membership.members) == "a") {
+			t.Errorf("Owns disagrees with Owner for %s", id)
+		}
+		if Owns(membership, "github", id) {
+			owned++
+		}
+	}
+	if owned == 0 || owned == 50 {
+		t.Errorf("a owns %d of 50 repositories, want a share", owned)
+	}
+}
@@ -0,0 +1,408 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/history"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// The upserts only touch rows that were not manually corrected, like the
+// conditional updates of the Cassandra backend. An upsert that failed wrote
+// nothing, so it has no changes.
+
+// idChunkSize is the number of ids read with one IN query, well below the
+// limits on the number of parameters.
+const idChunkSize = 500
+
+func (s *Store) InsertRepository(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Change, []storage.RowError) {
+	stored, err := s.listRepositories(ctx, adapter, "manually_corrected IS NOT TRUE AND id = ?", repository.Id)
+	if err != nil {
+		slog.Warn("Could not read the stored repository, its changes aren't recorded", "adapter", adapter.Name, "repository", repository.Id, internal.ErrorAttr(err))
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO repositories (adapter, id, full_name, default_branch, grouping_key, created_at, updated_at, manually_corrected) VALUES (?,?,?,?,?,?,?,false)
+		ON CONFLICT (adapter, id) DO UPDATE SET full_name = excluded.full_name, default_branch = excluded.default_branch, grouping_key = excluded.grouping_key, created_at = excluded.created_at, updated_at = excluded.updated_at
+		WHERE repositories.manually_corrected IS NOT TRUE`,
+		[][]any{{adapter.Name, repository.Id, repository.FullName, repository.DefaultBranch, repository.GroupingKey, utc(repository.CreatedAt), utc(repository.UpdatedAt)}})
+	if failures != nil {
+		return nil, failures
+	}
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityRepositories, stored, []internal.Repository{repository}), nil
+}
+
+func (s *Store) InsertIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository, issues []internal.Issue) ([]internal.Change, []storage.RowError) {
+	stored := overwritten(issues, func(condition string, args ...any) ([]internal.Issue, error) {
+		return s.listIssues(ctx, adapter, repository, condition, args...)
+	})
+
+	var values [][]any
+	for _, issue := range issues {
+		values = append(values, []any{adapter.Name, repository.Id, issue.ID, issue.Type, toJson(issue.PullRequests), utc(issue.CreatedAt), utcPointer(issue.ClosedAt)})
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO issues (adapter, repository_id, id, type, pull_request_ids, created_at, closed_at, manually_corrected) VALUES (?,?,?,?,?,?,?,false)
+		ON CONFLICT (adapter, repository_id, id) DO UPDATE SET type = excluded.type, pull_request_ids = excluded.pull_request_ids, created_at = excluded.created_at, closed_at = excluded.closed_at, deleted_at = NULL
+		WHERE issues.manually_corrected IS NOT TRUE`, values)
+	if failures != nil {
+		return nil, failures
+	}
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityIssues, stored, issues), nil
+}
+
+func (s *Store) InsertCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository, commits []internal.Commit) []storage.RowError {
+	var values [][]any
+	for _, commit := range commits {
+		values = append(values, []any{adapter.Name, repository.Id, commit.Sha, utc(commit.CreatedAt)})
+	}
+
+	return s.execBatch(ctx, `INSERT INTO commits (adapter, repository_id, id, created_at, manually_corrected) VALUES (?,?,?,?,false)
+		ON CONFLICT (adapter, repository_id, id) DO UPDATE SET created_at = excluded.created_at
+		WHERE commits.manually_corrected IS NOT TRUE`, values)
+}
+
+func (s *Store) InsertPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository, pullRequests []internal.PullRequest) ([]internal.Change, []storage.RowError) {
+	stored := overwritten(pullRequests, func(condition string, args ...any) ([]internal.PullRequest, error) {
+		return s.listPullRequests(ctx, adapter, repository, condition, args...)
+	})
+
+	var values [][]any
+	for _, pullRequest := range pullRequests {
+		var issueIds []string
+		var commitIds []string
+
+		for _, issue := range pullRequest.Issues {
+			issueIds = append(issueIds, issue.ID)
+		}
+		for _, commit := range pullRequest.Commits {
+			commitIds = append(commitIds, commit.Sha)
+		}
+
+		values = append(values, []any{adapter.Name, repository.Id, pullRequest.ID, toJson(pullRequest.Head), toJson(pullRequest.Base), toJson(issueIds), toJson(commitIds),
+			utcPointer(pullRequest.ClosedAt), utcPointer(pullRequest.MergedAt), utc(pullRequest.CreatedAt)})
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO pull_requests (adapter, repository_id, id, head, base, issue_ids, commit_ids, closed_at, merged_at, created_at, manually_corrected) VALUES (?,?,?,?,?,?,?,?,?,?,false)
+		ON CONFLICT (adapter, repository_id, id) DO UPDATE SET head = excluded.head, base = excluded.base, issue_ids = excluded.issue_ids, commit_ids = excluded.commit_ids, closed_at = excluded.closed_at, merged_at = excluded.merged_at, created_at = excluded.created_at, deleted_at = NULL
+		WHERE pull_requests.manually_corrected IS NOT TRUE`, values)
+	if failures != nil {
+		return nil, failures
+	}
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityPullRequests, stored, pullRequests), nil
+}
+
+func (s *Store) InsertDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, deployments []internal.Deployment) ([]internal.Change, []storage.RowError) {
+	stored := overwritten(deployments, func(condition string, args ...any) ([]internal.Deployment, error) {
+		return s.listDeployments(ctx, adapter, repository, condition, args...)
+	})
+
+	var values [][]any
+	for _, deployment := range deployments {
+		var commitId *string
+		var environmentId *string
+
+		if deployment.Commit != nil {
+			commitId = &deployment.Commit.Sha
+		}
+		if deployment.Environment != nil {
+			environmentId = &deployment.Environment.Id
+		}
+
+		values = append(values, []any{adapter.Name, repository.Id, deployment.Id, deployment.Sha, commitId, deployment.Ref, deployment.Task, environmentId, utc(deployment.CreatedAt), utc(deployment.UpdatedAt)})
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO deployments (adapter, repository_id, id, sha, commit_id, ref, task, environment_id, created_at, updated_at, manually_corrected) VALUES (?,?,?,?,?,?,?,?,?,?,false)
+		ON CONFLICT (adapter, repository_id, id) DO UPDATE SET sha = excluded.sha, commit_id = excluded.commit_id, ref = excluded.ref, task = excluded.task, environment_id = excluded.environment_id, created_at = excluded.created_at, updated_at = excluded.updated_at, deleted_at = NULL
+		WHERE deployments.manually_corrected IS NOT TRUE`, values)
+	if failures != nil {
+		return nil, failures
+	}
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityDeployments, stored, deployments), nil
+}
+
+func (s *Store) InsertEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, environments []internal.Environment) ([]internal.Change, []storage.RowError) {
+	stored := overwritten(environments, func(condition string, args ...any) ([]internal.Environment, error) {
+		return s.listEnvironments(ctx, adapter, repository, condition, args...)
+	})
+
+	var values [][]any
+	for _, environment := range environments {
+		values = append(values, []any{adapter.Name, repository.Id, environment.Id, environment.Name, utc(environment.CreatedAt), utc(environment.UpdatedAt)})
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO environments (adapter, repository_id, id, name, created_at, updated_at, manually_corrected) VALUES (?,?,?,?,?,?,false)
+		ON CONFLICT (adapter, repository_id, id) DO UPDATE SET name = excluded.name, created_at = excluded.created_at, updated_at = excluded.updated_at, deleted_at = NULL
+		WHERE environments.manually_corrected IS NOT TRUE`, values)
+	if failures != nil {
+		return nil, failures
+	}
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityEnvironments, stored, environments), nil
+}
+
+func (s *Store) ListIds(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string) (ids []string, err error) {
+	switch entity {
+	case storage.EntityIssues, storage.EntityPullRequests, storage.EntityDeployments, storage.EntityEnvironments:
+	default:
+		return nil, fmt.Errorf("unknown entity %q", entity)
+	}
+
+	err = s.read(ctx, "SELECT id FROM "+entity+" WHERE adapter = ? AND repository_id = ? AND deleted_at IS NULL ORDER BY id", []any{adapter.Name, repository.Id}, func(rows *sql.Rows) error {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+		return nil
+	})
+
+	return
+}
+
+func (s *Store) GetItem(ctx context.Context, adapter internal.Adapter, repositoryId string, entity string, id string) (any, error) {
+	repository := internal.Repository{Id: repositoryId}
+
+	switch entity {
+	case storage.EntityRepositories:
+		return first(s.listRepositories(ctx, adapter, "id = ?", id))
+	case storage.EntityIssues:
+		return first(s.listIssues(ctx, adapter, repository, "id = ?", id))
+	case storage.EntityPullRequests:
+		return first(s.listPullRequests(ctx, adapter, repository, "id = ?", id))
+	case storage.EntityDeployments:
+		return first(s.listDeployments(ctx, adapter, repository, "id = ?", id))
+	case storage.EntityEnvironments:
+		return first(s.listEnvironments(ctx, adapter, repository, "id = ?", id))
+	}
+
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+// first returns the item of a read by id, or nil if there is none.
+func first[T any](items []T, err error) (any, error) {
+	if len(items) == 0 {
+		return nil, err
+	}
+
+	return items[0], err
+}
+
+func (s *Store) MarkDeleted(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string, ids []string, deletedAt time.Time) []storage.RowError {
+	statement := "UPDATE " + entity + " SET deleted_at = ? WHERE adapter = ? AND repository_id = ? AND id = ? AND manually_corrected IS NOT TRUE"
+
+	var values [][]any
+	for _, id := range ids {
+		values = append(values, []any{utc(deletedAt), adapter.Name, repository.Id, id})
+	}
+
+	switch entity {
+	case storage.EntityIssues, storage.EntityPullRequests, storage.EntityDeployments, storage.EntityEnvironments:
+	default:
+		return failed(statement, values, fmt.Errorf("unknown entity %q", entity))
+	}
+
+	return s.execBatch(ctx, statement, values)
+}
+
+func (s *Store) ListRepositories(ctx context.Context, adapter internal.Adapter) ([]internal.Repository, error) {
+	return s.listRepositories(ctx, adapter, "TRUE")
+}
+
+// listRepositories reads the repositories that match condition.
+func (s *Store) listRepositories(ctx context.Context, adapter internal.Adapter, condition string, args ...any) (repos []internal.Repository, err error) {
+	err = s.read(ctx, "SELECT id, full_name, default_branch, grouping_key, created_at, updated_at FROM repositories WHERE adapter = ? AND "+condition+" ORDER BY id", append([]any{adapter.Name}, args...), func(rows *sql.Rows) error {
+		var repo internal.Repository
+		if err := rows.Scan(&repo.Id, &repo.FullName, &repo.DefaultBranch, &repo.GroupingKey, &repo.CreatedAt, &repo.UpdatedAt); err != nil {
+			return err
+		}
+
+		repos = append(repos, repo)
+		return nil
+	})
+
+	return
+}
+
+func (s *Store) ListIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Issue, error) {
+	return s.listIssues(ctx, adapter, repository, "TRUE")
+}
+
+// listIssues reads the issues of the repository that aren't deleted and match
+// condition.
+func (s *Store) listIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository, condition string, args ...any) (issues []internal.Issue, err error) {
+	err = s.read(ctx, "SELECT id, type, pull_request_ids, created_at, closed_at FROM issues WHERE adapter = ? AND repository_id = ? AND deleted_at IS NULL AND "+condition+" ORDER BY id", append([]any{adapter.Name, repository.Id}, args...), func(rows *sql.Rows) error {
+		var issue internal.Issue
+		var issueType sql.NullString
+		var pullRequestIds []byte
+		var closedAt sql.NullTime
+
+		if err := rows.Scan(&issue.ID, &issueType, &pullRequestIds, &issue.CreatedAt, &closedAt); err != nil {
+			return err
+		}
+		if err := fromJson(pullRequestIds, &issue.PullRequests); err != nil {
+			return err
+		}
+		issue.Type = nullString(issueType)
+		issue.ClosedAt = nullTime(closedAt)
+		issue.Repo = &repository
+
+		issues = append(issues, issue)
+		return nil
+	})
+
+	return
+}
+
+func (s *Store) ListCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (commits []internal.Commit, err error) {
+	err = s.read(ctx, "SELECT id, created_at FROM commits WHERE adapter = ? AND repository_id = ? ORDER BY id", []any{adapter.Name, repository.Id}, func(rows *sql.Rows) error {
+		commit := internal.Commit{Repo: &repository}
+		if err := rows.Scan(&commit.Sha, &commit.CreatedAt); err != nil {
+			return err
+		}
+
+		commits = append(commits, commit)
+		return nil
+	})
+
+	return
+}
+
+func (s *Store) ListPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.PullRequest, error) {
+	return s.listPullRequests(ctx, adapter, repository, "TRUE")
+}
+
+// listPullRequests reads the pull requests of the repository that aren't deleted and match
+// condition.
+func (s *Store) listPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository, condition string, args ...any) (pullRequests []internal.PullRequest, err error) {
+	err = s.read(ctx, "SELECT id, head, base, issue_ids, commit_ids, closed_at, merged_at, created_at FROM pull_requests WHERE adapter = ? AND repository_id = ? AND deleted_at IS NULL AND "+condition+" ORDER BY id", append([]any{adapter.Name, repository.Id}, args...), func(rows *sql.Rows) error {
+		var pullRequest internal.PullRequest
+		var head, base, issueIds, commitIds []byte
+		var closedAt, mergedAt sql.NullTime
+
+		if err := rows.Scan(&pullRequest.ID, &head, &base, &issueIds, &commitIds, &closedAt, &mergedAt, &pullRequest.CreatedAt); err != nil {
+			return err
+		}
+
+		var ids, commits []string
+		err := errors.Join(fromJson(head, &pullRequest.Head), fromJson(base, &pullRequest.Base), fromJson(issueIds, &ids), fromJson(commitIds, &commits))
+		if err != nil {
+			return err
+		}
+		pullRequest.ClosedAt = nullTime(closedAt)
+		pullRequest.MergedAt = nullTime(mergedAt)
+		pullRequest.Repo = &repository
+
+		for _, id := range ids {
+			pullRequest.Issues = append(pullRequest.Issues, internal.Issue{WorkItem: internal.WorkItem{ID: id, Repo: &repository}})
+		}
+		for _, id := range commits {
+			pullRequest.Commits = append(pullRequest.Commits, internal.Commit{Sha: id, Repo: &repository})
+		}
+
+		pullRequests = append(pullRequests, pullRequest)
+		return nil
+	})
+
+	return
+}
+
+func (s *Store) ListDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Deployment, error) {
+	return s.listDeployments(ctx, adapter, repository, "TRUE")
+}
+
+// listDeployments reads the deployments of the repository that aren't deleted and match
+// condition.
+func (s *Store) listDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, condition string, args ...any) (deployments []internal.Deployment, err error) {
+	err = s.read(ctx, "SELECT id, sha, commit_id, ref, task, environment_id, created_at, updated_at FROM deployments WHERE adapter = ? AND repository_id = ? AND deleted_at IS NULL AND "+condition+" ORDER BY id", append([]any{adapter.Name, repository.Id}, args...), func(rows *sql.Rows) error {
+		var deployment internal.Deployment
+		var commitId, environmentId sql.NullString
+
+		if err := rows.Scan(&deployment.Id, &deployment.Sha, &commitId, &deployment.Ref, &deployment.Task, &environmentId, &deployment.CreatedAt, &deployment.UpdatedAt); err != nil {
+			return err
+		}
+		if commitId.Valid {
+			deployment.Commit = &internal.Commit{Sha: commitId.String, Repo: &repository}
+		}
+		if environmentId.Valid {
+			deployment.Environment = &internal.Environment{Id: environmentId.String, Name: environmentId.String}
+		}
+
+		deployments = append(deployments, deployment)
+		return nil
+	})
+
+	return
+}
+
+func (s *Store) ListEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Environment, error) {
+	return s.listEnvironments(ctx, adapter, repository, "TRUE")
+}
+
+// listEnvironments reads the environments of the repository that aren't deleted and match
+// condition.
+func (s *Store) listEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, condition string, args ...any) (environments []internal.Environment, err error) {
+	err = s.read(ctx, "SELECT id, name, created_at, updated_at FROM environments WHERE adapter = ? AND repository_id = ? AND deleted_at IS NULL AND "+condition+" ORDER BY id", append([]any{adapter.Name, repository.Id}, args...), func(rows *sql.Rows) error {
+		var environment internal.Environment
+		if err := rows.Scan(&environment.Id, &environment.Name, &environment.CreatedAt, &environment.UpdatedAt); err != nil {
+			return err
+		}
+
+		environments = append(environments, environment)
+		return nil
+	})
+
+	return
+}
+
+// overwritten reads the stored rows that an upsert of items overwrites, in
+// chunks of idChunkSize ids. Manually corrected rows are kept and deleted ones
+// count as new, so neither is returned. The rows are written regardless, so the
+// changes of a chunk that can't be read are logged and skipped.
+func overwritten[T any](items []T, list func(condition string, args ...any) ([]T, error)) (stored []T) {
+	for i := 0; i < len(items); i += idChunkSize {
+		var ids []any
+		for _, item := range items[i:min(i+idChunkSize, len(items))] {
+			ids = append(ids, history.Id(item))
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+		rows, err := list("manually_corrected IS NOT TRUE AND id IN ("+placeholders+")", ids...)
+		if err != nil {
+			slog.Warn("Could not read the stored rows, their changes aren't recorded", "rows", len(ids), internal.ErrorAttr(err))
+			continue
+		}
+		stored = append(stored, rows...)
+	}
+
+	return
+}
+
+// toJson encodes sets and user defined types, which are stored as JSON.
+func toJson(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	return string(encoded)
+}
+
+func fromJson(encoded []byte, value any) error {
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(encoded, value)
+}
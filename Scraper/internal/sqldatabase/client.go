@@ -0,0 +1,290 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// Dialect describes the differences between the SQL databases the Store runs
+// on. Statements are written with ? placeholders and rebound for the driver.
+type Dialect struct {
+	Name       string
+	Driver     string
+	Rebind     func(statement string) string
+	Migrations fs.FS
+	// MaxConnections limits the open connections, 0 means no limit
+	MaxConnections int
+}
+
+// Store implements storage.Store on top of a relational database. Its tables
+// mirror the Cassandra keyspaces, with sets and user defined types stored as
+// JSON. A write runs in one transaction, so a failed row fails all rows of the
+// write.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ storage.Store = (*Store)(nil)
+
+func Open(dialect Dialect, dsn string) *Store {
+	db, err := sql.Open(dialect.Driver, dsn)
+	if err != nil {
+		internal.ProcessError(err)
+		return nil
+	}
+
+	db.SetMaxOpenConns(dialect.MaxConnections)
+
+	store := &Store{db: db, dialect: dialect}
+	Migrate(context.Background(), store)
+
+	return store
+}
+
+// QuestionMarks keeps ? placeholders as they are.
+func QuestionMarks(statement string) string {
+	return statement
+}
+
+// DollarNumbers turns ? placeholders into $1, $2, ...
+func DollarNumbers(statement string) string {
+	var builder strings.Builder
+	index := 0
+
+	for _, char := range statement {
+		if char == '?' {
+			index++
+			builder.WriteString(fmt.Sprintf("$%d", index))
+		} else {
+			builder.WriteRune(char)
+		}
+	}
+
+	return builder.String()
+}
+
+// Migrate applies all migrations of the dialect that were not applied yet, each
+// in its own transaction.
+func Migrate(ctx context.Context, s *Store) {
+	if _, err := s.exec(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY, applied_at TIMESTAMP NOT NULL)"); err != nil {
+		internal.ProcessError(err)
+	}
+
+	applied := appliedMigrations(ctx, s)
+
+	for _, version := range migrationVersions(s) {
+		if _, ok := applied[version]; ok {
+			continue
+		}
+
+		statements, err := fs.ReadFile(s.dialect.Migrations, version+".sql")
+		if err != nil {
+			internal.ProcessError(err)
+		}
+
+		err = s.transaction(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, string(statements)); err != nil {
+				return err
+			}
+
+			_, err := tx.ExecContext(ctx, s.dialect.Rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?,?)"), version, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			internal.ProcessError(fmt.Errorf("migration %s: %w", version, err))
+		}
+
+		slog.Info("Applied migration", "backend", s.dialect.Name, "version", version)
+	}
+}
+
+// MigrationStatus lists the migrations of the dialect and the ones found in the
+// database, ordered by version.
+func MigrationStatus(ctx context.Context, s *Store) (status []storage.Migration) {
+	applied := appliedMigrations(ctx, s)
+
+	known := migrationVersions(s)
+	versions := slices.Clone(known)
+	for version := range applied {
+		if !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+
+	for _, version := range versions {
+		migration := storage.Migration{Version: version, Known: slices.Contains(known, version)}
+		if appliedAt, ok := applied[version]; ok {
+			migration.AppliedAt = &appliedAt
+		}
+
+		status = append(status, migration)
+	}
+
+	return
+}
+
+func appliedMigrations(ctx context.Context, s *Store) map[string]time.Time {
+	applied := make(map[string]time.Time)
+
+	err := s.read(ctx, "SELECT version, applied_at FROM schema_migrations", nil, func(rows *sql.Rows) error {
+		var version string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return err
+		}
+
+		applied[version] = appliedAt
+		return nil
+	})
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	return applied
+}
+
+func migrationVersions(s *Store) (versions []string) {
+	names, err := fs.Glob(s.dialect.Migrations, "*.sql")
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	for _, name := range names {
+		versions = append(versions, strings.TrimSuffix(name, ".sql"))
+	}
+	sort.Strings(versions)
+
+	return
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Store) Close() {
+	err := s.db.Close()
+	if err != nil {
+		internal.ProcessError(err)
+	}
+}
+
+func (s *Store) exec(ctx context.Context, statement string, values ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.dialect.Rebind(statement), values...)
+}
+
+// read runs a query and calls scan for every row. Unlike the writes, it
+// returns its errors to the caller. The rows are closed when it returns, so a
+// write may follow on the single connection of SQLite.
+func (s *Store) read(ctx context.Context, statement string, values []any, scan func(rows *sql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(statement), values...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// transaction runs work in one transaction, which is rolled back if work
+// returns an error.
+func (s *Store) transaction(ctx context.Context, work func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := work(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+// execBatch runs statement once for every row of values in one transaction. If
+// a row fails, the transaction is rolled back, so all rows are returned as
+// failed.
+func (s *Store) execBatch(ctx context.Context, statement string, values [][]any) []storage.RowError {
+	if len(values) == 0 {
+		return nil
+	}
+
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		prepared, err := tx.PrepareContext(ctx, s.dialect.Rebind(statement))
+		if err != nil {
+			return err
+		}
+		defer prepared.Close()
+
+		for _, args := range values {
+			if _, err := prepared.ExecContext(ctx, args...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return failed(statement, values, err)
+}
+
+// failed returns every row of values as failed with err, or nil if there is no
+// error.
+func failed(statement string, values [][]any, err error) (failures []storage.RowError) {
+	if err == nil {
+		return nil
+	}
+
+	slog.Error("Could not write rows", "statement", statement, "rows", len(values), internal.ErrorAttr(err))
+	for _, args := range values {
+		failures = append(failures, storage.RowError{Statement: statement, Args: args, Err: err})
+	}
+
+	return
+}
+
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func utcPointer(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	converted := t.UTC()
+	return &converted
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.Time
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+
+	return &s.String
+}
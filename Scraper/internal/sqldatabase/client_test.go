@@ -0,0 +1,25 @@
+package sqldatabase
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name      string
+		rebind    func(statement string) string
+		statement string
+		want      string
+	}{
+		{"question marks", QuestionMarks, "SELECT id FROM issues WHERE adapter = ? AND repository_id = ?", "SELECT id FROM issues WHERE adapter = ? AND repository_id = ?"},
+		{"no placeholders", DollarNumbers, "SELECT version FROM schema_migrations", "SELECT version FROM schema_migrations"},
+		{"one placeholder", DollarNumbers, "DELETE FROM leases WHERE name = ?", "DELETE FROM leases WHERE name = $1"},
+		{"several placeholders", DollarNumbers, "INSERT INTO commits (adapter, repository_id, id) VALUES (?,?,?)", "INSERT INTO commits (adapter, repository_id, id) VALUES ($1,$2,$3)"},
+		{"more than nine", DollarNumbers, "VALUES (?,?,?,?,?,?,?,?,?,?,?)", "VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)"},
+		{"unicode", DollarNumbers, "SELECT ? AS ümlaut", "SELECT $1 AS ümlaut"},
+	}
+
+	for _, test := range tests {
+		if got := test.rebind(test.statement); got != test.want {
+			t.Errorf("%s: rebind(%q) = %q, want %q", test.name, test.statement, got, test.want)
+		}
+	}
+}
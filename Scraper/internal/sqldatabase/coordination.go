@@ -0,0 +1,120 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"thesis/scraper/internal"
+	"time"
+)
+
+func (s *Store) InsertScrapeRun(ctx context.Context, run internal.ScrapeRun) {
+	_, err := s.exec(ctx, `INSERT INTO scrape_runs (adapter, repository_id, stage, started_at, run_id, finished_at, status, counts, errors, instance, scraper_version) VALUES (?,?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT (adapter, repository_id, stage, started_at, run_id) DO UPDATE SET finished_at = excluded.finished_at, status = excluded.status, counts = excluded.counts, errors = excluded.errors, instance = excluded.instance, scraper_version = excluded.scraper_version`,
+		run.Adapter, run.RepositoryId, run.Stage, utc(run.StartedAt), run.RunId, utcPointer(run.FinishedAt), run.Status, toJson(run.Counts), toJson(run.Errors), run.Instance, run.ScraperVersion)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+}
+
+func (s *Store) ListScrapeRuns(ctx context.Context, adapter string, repositoryId string, limit int) (runs []internal.ScrapeRun, err error) {
+	statement := "SELECT adapter, repository_id, stage, started_at, run_id, finished_at, status, counts, errors, instance, scraper_version FROM scrape_runs WHERE (? = '' OR adapter = ?) AND (? = '' OR repository_id = ?) ORDER BY started_at DESC"
+	values := []any{adapter, adapter, repositoryId, repositoryId}
+	if limit > 0 {
+		statement += " LIMIT ?"
+		values = append(values, limit)
+	}
+
+	err = s.read(ctx, statement, values, func(rows *sql.Rows) error {
+		var run internal.ScrapeRun
+		var finishedAt sql.NullTime
+		var counts, runErrors []byte
+
+		if err := rows.Scan(&run.Adapter, &run.RepositoryId, &run.Stage, &run.StartedAt, &run.RunId, &finishedAt, &run.Status, &counts, &runErrors, &run.Instance, &run.ScraperVersion); err != nil {
+			return err
+		}
+		if err := errors.Join(fromJson(counts, &run.Counts), fromJson(runErrors, &run.Errors)); err != nil {
+			return err
+		}
+		run.FinishedAt = nullTime(finishedAt)
+
+		runs = append(runs, run)
+		return nil
+	})
+
+	return
+}
+
+// Leases and instances store their expiry as unix milliseconds, which compare
+// the same way in every database.
+
+func (s *Store) TryAcquireLease(name string, owner string, duration time.Duration) bool {
+	now := time.Now()
+	result, err := s.exec(context.Background(), `INSERT INTO leases (name, owner, acquired_at, expires_at) VALUES (?,?,?,?)
+		ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, acquired_at = excluded.acquired_at, expires_at = excluded.expires_at
+		WHERE leases.owner = excluded.owner OR leases.expires_at < ?`,
+		name, owner, now.UTC(), now.Add(duration).UnixMilli(), now.UnixMilli())
+
+	return changedRows(name, result, err)
+}
+
+func (s *Store) RenewLease(name string, owner string, duration time.Duration) bool {
+	now := time.Now()
+	result, err := s.exec(context.Background(), "UPDATE leases SET expires_at = ? WHERE name = ? AND owner = ? AND expires_at >= ?",
+		now.Add(duration).UnixMilli(), name, owner, now.UnixMilli())
+
+	return changedRows(name, result, err)
+}
+
+func (s *Store) DeleteLease(name string, owner string) {
+	if _, err := s.exec(context.Background(), "DELETE FROM leases WHERE name = ? AND owner = ?", name, owner); err != nil {
+		// The lease expires on its own
+		slog.Warn("Could not delete lease", "lease", name, internal.ErrorAttr(err))
+	}
+}
+
+func (s *Store) RegisterInstance(id string, startedAt time.Time, ttl time.Duration) {
+	now := time.Now()
+	_, err := s.exec(context.Background(), `INSERT INTO scraper_instances (id, started_at, heartbeat_at, expires_at) VALUES (?,?,?,?)
+		ON CONFLICT (id) DO UPDATE SET started_at = excluded.started_at, heartbeat_at = excluded.heartbeat_at, expires_at = excluded.expires_at`,
+		id, startedAt.UTC(), now.UTC(), now.Add(ttl).UnixMilli())
+	if err != nil {
+		slog.Warn("Could not register instance", "instance", id, internal.ErrorAttr(err))
+	}
+}
+
+func (s *Store) UnregisterInstance(id string) {
+	if _, err := s.exec(context.Background(), "DELETE FROM scraper_instances WHERE id = ?", id); err != nil {
+		// The row expires on its own
+		slog.Warn("Could not unregister instance", "instance", id, internal.ErrorAttr(err))
+	}
+}
+
+// changedRows reports whether a statement on a lease changed any row. A failed
+// statement is logged and counts as not holding the lease.
+func changedRows(lease string, result sql.Result, err error) bool {
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil {
+			return affected > 0
+		}
+	}
+
+	slog.Warn("Could not write lease", "lease", lease, internal.ErrorAttr(err))
+	return false
+}
+
+func (s *Store) ListInstances() (ids []string, err error) {
+	err = s.read(context.Background(), "SELECT id FROM scraper_instances WHERE expires_at > ? ORDER BY id", []any{time.Now().UnixMilli()}, func(rows *sql.Rows) error {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+		return nil
+	})
+
+	return
+}
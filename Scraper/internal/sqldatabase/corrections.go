@@ -0,0 +1,117 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+)
+
+func (s *Store) ApplyCorrection(ctx context.Context, correction internal.Correction, values map[string]any) error {
+	var fields []string
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var assignments []string
+	var args []any
+	for _, field := range fields {
+		assignments = append(assignments, field+" = ?")
+		args = append(args, values[field])
+	}
+
+	condition := "adapter = ? AND repository_id = ? AND id = ?"
+	args = append(args, correction.Adapter, correction.RepositoryId, correction.Id)
+	if correction.Entity == storage.EntityRepositories {
+		condition = "adapter = ? AND id = ?"
+		args = append(args[:len(fields)], correction.Adapter, correction.Id)
+	}
+
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		var previous *internal.Repository
+		if correction.Entity == storage.EntityRepositories {
+			var err error
+			if previous, err = s.storedRepository(ctx, tx, correction.Adapter, correction.Id); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, s.dialect.Rebind(fmt.Sprintf("UPDATE %s SET %s, manually_corrected = true WHERE %s", correction.Entity, strings.Join(assignments, ", "), condition)), args...)
+		if err != nil {
+			return err
+		}
+
+		if groupingKey, ok := values["grouping_key"]; ok && previous != nil && groupingKey != previous.GroupingKey {
+			if err := s.deleteGroupedMetrics(ctx, tx, correction.Adapter, *previous); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, s.dialect.Rebind("INSERT INTO corrections (adapter, repository_id, corrected_at, entity, id, fields, author) VALUES (?,?,?,?,?,?,?)"),
+			correction.Adapter, correction.RepositoryId, utc(correction.CorrectedAt), correction.Entity, correction.Id, toJson(correction.Fields), correction.Author)
+		return err
+	})
+}
+
+// storedRepository returns the grouping key and the name of a stored
+// repository, or nil if it isn't stored.
+func (s *Store) storedRepository(ctx context.Context, tx *sql.Tx, adapter string, id string) (*internal.Repository, error) {
+	var groupingKey, fullName sql.NullString
+	err := tx.QueryRowContext(ctx, s.dialect.Rebind("SELECT grouping_key, full_name FROM repositories WHERE adapter = ? AND id = ?"), adapter, id).Scan(&groupingKey, &fullName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &internal.Repository{Id: id, GroupingKey: groupingKey.String, FullName: fullName.String}, nil
+}
+
+// deleteGroupedMetrics deletes the metrics a repository stored under its
+// previous grouping key, which would otherwise stay in the old group. The next
+// aggregation stores them under the corrected key. The change failure rate is
+// shared by the group, so it is only deleted with the last repository.
+func (s *Store) deleteGroupedMetrics(ctx context.Context, tx *sql.Tx, adapter string, previous internal.Repository) error {
+	statements := []struct {
+		statement string
+		args      []any
+	}{
+		{"DELETE FROM deployment_frequencies WHERE adapter = ? AND grouping_key = ? AND repository_id = ?", []any{adapter, previous.GroupingKey, previous.Id}},
+		{"DELETE FROM lead_times WHERE adapter = ? AND repository_id = ? AND (issue_repository_id = ? OR issue_repository_id IS NULL AND repository_name = ?)", []any{adapter, previous.GroupingKey, previous.Id, previous.FullName}},
+		{"DELETE FROM times_to_restore_service WHERE adapter = ? AND repository_id = ? AND (issue_repository_id = ? OR issue_repository_id IS NULL AND repository_name = ?)", []any{adapter, previous.GroupingKey, previous.Id, previous.FullName}},
+		{"DELETE FROM change_failure_rates WHERE adapter = ? AND repository_id = ? AND NOT EXISTS (SELECT 1 FROM repositories WHERE adapter = ? AND grouping_key = ?)", []any{adapter, previous.GroupingKey, adapter, previous.GroupingKey}},
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, s.dialect.Rebind(statement.statement), statement.args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) ListCorrections(ctx context.Context, adapter string, repositoryId string) (corrections []internal.Correction, err error) {
+	err = s.read(ctx, "SELECT adapter, repository_id, corrected_at, entity, id, fields, author FROM corrections WHERE adapter = ? AND repository_id = ? ORDER BY corrected_at DESC, entity, id", []any{adapter, repositoryId}, func(rows *sql.Rows) error {
+		var correction internal.Correction
+		var fields []byte
+
+		if err := rows.Scan(&correction.Adapter, &correction.RepositoryId, &correction.CorrectedAt, &correction.Entity, &correction.Id, &fields, &correction.Author); err != nil {
+			return err
+		}
+		if err := fromJson(fields, &correction.Fields); err != nil {
+			return err
+		}
+
+		corrections = append(corrections, correction)
+		return nil
+	})
+
+	return
+}
@@ -0,0 +1,32 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+)
+
+func (s *Store) InsertChanges(ctx context.Context, changes []internal.Change) []storage.RowError {
+	var values [][]any
+	for _, change := range changes {
+		values = append(values, []any{change.Adapter, change.RepositoryId, change.Entity, change.Id, utc(change.ChangedAt), change.Field, change.OldValue, change.NewValue, change.Source})
+	}
+
+	return s.execBatch(ctx, `INSERT INTO changes (adapter, repository_id, entity, id, changed_at, field, old_value, new_value, source) VALUES (?,?,?,?,?,?,?,?,?)
+		ON CONFLICT (adapter, repository_id, entity, id, changed_at, field) DO NOTHING`, values)
+}
+
+func (s *Store) ListChanges(ctx context.Context, adapter string, repositoryId string, entity string, id string) (changes []internal.Change, err error) {
+	err = s.read(ctx, "SELECT changed_at, field, old_value, new_value, source FROM changes WHERE adapter = ? AND repository_id = ? AND entity = ? AND id = ? ORDER BY changed_at DESC, field", []any{adapter, repositoryId, entity, id}, func(rows *sql.Rows) error {
+		change := internal.Change{Adapter: adapter, RepositoryId: repositoryId, Entity: entity, Id: id}
+		if err := rows.Scan(&change.ChangedAt, &change.Field, &change.OldValue, &change.NewValue, &change.Source); err != nil {
+			return err
+		}
+
+		changes = append(changes, change)
+		return nil
+	})
+
+	return
+}
@@ -0,0 +1,173 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+// Like in Cassandra, lead times, change failure rates and times to restore
+// service are stored under the grouping key of the repository.
+
+func (s *Store) InsertDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository, frequencies map[string]int) []storage.RowError {
+	var values [][]any
+	for date, frequency := range frequencies {
+		timestamp, _ := time.Parse(time.DateOnly, date)
+		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.Id, repository.FullName, timestamp, frequency})
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO deployment_frequencies (adapter, grouping_key, repository_id, repository_name, date, frequency) VALUES (?,?,?,?,?,?)
+		ON CONFLICT (adapter, grouping_key, repository_id, date) DO UPDATE SET repository_name = excluded.repository_name, frequency = excluded.frequency`, values)
+	vanished, readFailures := s.vanishedDates(ctx, adapter, repository, frequencies)
+	failures = append(failures, readFailures...)
+
+	return append(failures, s.execBatch(ctx, "DELETE FROM deployment_frequencies WHERE adapter = ? AND grouping_key = ? AND repository_id = ? AND date = ?", vanished)...)
+}
+
+// vanishedDates returns the keys of the deployment frequencies of the
+// repository on dates it no longer has, after deployments were deleted. A
+// failed read is returned as a failed row and deletes nothing.
+func (s *Store) vanishedDates(ctx context.Context, adapter internal.Adapter, repository internal.Repository, frequencies map[string]int) (vanished [][]any, failures []storage.RowError) {
+	statement := "SELECT date FROM deployment_frequencies WHERE adapter = ? AND grouping_key = ? AND repository_id = ?"
+	args := []any{adapter.Name, repository.GroupingKey, repository.Id}
+	err := s.read(ctx, statement, args, func(rows *sql.Rows) error {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return err
+		}
+
+		if _, ok := frequencies[date.UTC().Format(time.DateOnly)]; !ok {
+			vanished = append(vanished, []any{adapter.Name, repository.GroupingKey, repository.Id, date})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, failed(statement, [][]any{args}, err)
+	}
+
+	return
+}
+
+func (s *Store) InsertLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository, leadTimes map[string]internal.IssueDuration) []storage.RowError {
+	var values [][]any
+	for issueId, leadTime := range leadTimes {
+		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.FullName, issueId, int64(leadTime.Duration), milliseconds(leadTime.Duration), utc(leadTime.CreatedAt), repository.Id})
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO lead_times (adapter, repository_id, repository_name, issue_id, lead_time_nanoseconds, lead_time_milliseconds, issue_created_at, issue_repository_id) VALUES (?,?,?,?,?,?,?,?)
+		ON CONFLICT (adapter, repository_id, issue_id) DO UPDATE SET repository_name = excluded.repository_name, lead_time_nanoseconds = excluded.lead_time_nanoseconds, lead_time_milliseconds = excluded.lead_time_milliseconds, issue_created_at = excluded.issue_created_at, issue_repository_id = excluded.issue_repository_id`, values)
+	vanished, readFailures := s.vanishedIssues(ctx, "lead_times", adapter, repository, leadTimes)
+	failures = append(failures, readFailures...)
+
+	return append(failures, s.execBatch(ctx, "DELETE FROM lead_times WHERE adapter = ? AND repository_id = ? AND issue_id = ?", vanished)...)
+}
+
+func (s *Store) InsertChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository, changeFailureRate float64) []storage.RowError {
+	return s.execBatch(ctx, `INSERT INTO change_failure_rates (adapter, repository_id, repository_name, rate) VALUES (?,?,?,?)
+		ON CONFLICT (adapter, repository_id) DO UPDATE SET repository_name = excluded.repository_name, rate = excluded.rate`,
+		[][]any{{adapter.Name, repository.GroupingKey, repository.FullName, changeFailureRate}})
+}
+
+func (s *Store) InsertTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository, timesToRestoreService map[string]internal.IssueDuration) []storage.RowError {
+	var values [][]any
+	for issueId, timeToRestoreService := range timesToRestoreService {
+		values = append(values, []any{adapter.Name, repository.GroupingKey, repository.FullName, issueId, int64(timeToRestoreService.Duration), milliseconds(timeToRestoreService.Duration), utc(timeToRestoreService.CreatedAt), repository.Id})
+	}
+
+	failures := s.execBatch(ctx, `INSERT INTO times_to_restore_service (adapter, repository_id, repository_name, issue_id, time_to_restore_service_nanoseconds, time_to_restore_service_milliseconds, issue_created_at, issue_repository_id) VALUES (?,?,?,?,?,?,?,?)
+		ON CONFLICT (adapter, repository_id, issue_id) DO UPDATE SET repository_name = excluded.repository_name, time_to_restore_service_nanoseconds = excluded.time_to_restore_service_nanoseconds, time_to_restore_service_milliseconds = excluded.time_to_restore_service_milliseconds, issue_created_at = excluded.issue_created_at, issue_repository_id = excluded.issue_repository_id`, values)
+	vanished, readFailures := s.vanishedIssues(ctx, "times_to_restore_service", adapter, repository, timesToRestoreService)
+	failures = append(failures, readFailures...)
+
+	return append(failures, s.execBatch(ctx, "DELETE FROM times_to_restore_service WHERE adapter = ? AND repository_id = ? AND issue_id = ?", vanished)...)
+}
+
+// vanishedIssues returns the keys of the metrics of the issues of the repository
+// that are missing from durations, because the issues were deleted or no longer
+// count. Rows written before the repository of the issue was recorded are
+// matched by name. The rows are closed before they are deleted, SQLite has a
+// single connection. A failed read is returned as a failed row.
+func (s *Store) vanishedIssues(ctx context.Context, table string, adapter internal.Adapter, repository internal.Repository, durations map[string]internal.IssueDuration) (vanished [][]any, failures []storage.RowError) {
+	statement := "SELECT issue_id FROM " + table + " WHERE adapter = ? AND repository_id = ? AND (issue_repository_id = ? OR issue_repository_id IS NULL AND repository_name = ?)"
+	args := []any{adapter.Name, repository.GroupingKey, repository.Id, repository.FullName}
+	err := s.read(ctx, statement, args, func(rows *sql.Rows) error {
+		var issueId string
+		if err := rows.Scan(&issueId); err != nil {
+			return err
+		}
+
+		if _, ok := durations[issueId]; !ok {
+			vanished = append(vanished, []any{adapter.Name, repository.GroupingKey, issueId})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, failed(statement, [][]any{args}, err)
+	}
+
+	return
+}
+
+func (s *Store) ListDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]int, error) {
+	frequencies := make(map[string]int)
+
+	err := s.read(ctx, "SELECT date, frequency FROM deployment_frequencies WHERE adapter = ? AND grouping_key = ? AND repository_id = ?", []any{adapter.Name, repository.GroupingKey, repository.Id}, func(rows *sql.Rows) error {
+		var date time.Time
+		var frequency int
+		if err := rows.Scan(&date, &frequency); err != nil {
+			return err
+		}
+
+		frequencies[date.UTC().Format(time.DateOnly)] = frequency
+		return nil
+	})
+
+	return frequencies, err
+}
+
+func (s *Store) ListLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error) {
+	return s.listDurations(ctx, "SELECT issue_id, lead_time_nanoseconds FROM lead_times WHERE adapter = ? AND repository_id = ?", adapter, repository)
+}
+
+func (s *Store) ListChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (changeFailureRate float64, err error) {
+	err = s.db.QueryRowContext(ctx, s.dialect.Rebind("SELECT rate FROM change_failure_rates WHERE adapter = ? AND repository_id = ?"), adapter.Name, repository.GroupingKey).Scan(&changeFailureRate)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+
+	return
+}
+
+func (s *Store) ListTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error) {
+	return s.listDurations(ctx, "SELECT issue_id, time_to_restore_service_nanoseconds FROM times_to_restore_service WHERE adapter = ? AND repository_id = ?", adapter, repository)
+}
+
+func (s *Store) listDurations(ctx context.Context, statement string, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+
+	err := s.read(ctx, statement, []any{adapter.Name, repository.GroupingKey}, func(rows *sql.Rows) error {
+		var issueId string
+		var nanoseconds int64
+		if err := rows.Scan(&issueId, &nanoseconds); err != nil {
+			return err
+		}
+
+		durations[issueId] = time.Duration(nanoseconds)
+		return nil
+	})
+
+	return durations, err
+}
+
+// milliseconds is what the dashboards read. Negative durations are left out,
+// the same as in Cassandra.
+func milliseconds(duration time.Duration) *int64 {
+	if duration.Milliseconds() < 0 {
+		return nil
+	}
+
+	value := duration.Milliseconds()
+	return &value
+}
@@ -0,0 +1,23 @@
+package sqldatabase
+
+import (
+	"context"
+	"fmt"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+func (s *Store) Prune(ctx context.Context, table string, before time.Time) (int, error) {
+	column, ok := storage.RetentionColumns[table]
+	if !ok {
+		return 0, fmt.Errorf("%q can't be pruned", table)
+	}
+
+	result, err := s.exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s < ?", table, column), utc(before))
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
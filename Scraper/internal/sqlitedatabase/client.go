@@ -0,0 +1,37 @@
+package sqlitedatabase
+
+import (
+	"embed"
+	"io/fs"
+	_ "modernc.org/sqlite"
+	"net/url"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/sqldatabase"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens or creates the database file and applies all pending migrations.
+// Timestamps are written in the SQLite format, so Grafana's SQLite datasource
+// and the date functions of SQLite can read them.
+func Open(config internal.SqliteConfig) *sqldatabase.Store {
+	files, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		internal.ProcessError(err)
+	}
+
+	parameters := url.Values{}
+	parameters.Add("_time_format", "sqlite")
+	parameters.Add("_pragma", "busy_timeout(5000)")
+	parameters.Add("_pragma", "journal_mode(WAL)")
+
+	return sqldatabase.Open(sqldatabase.Dialect{
+		Name:       "sqlite",
+		Driver:     "sqlite",
+		Rebind:     sqldatabase.QuestionMarks,
+		Migrations: files,
+		// SQLite only allows a single writer
+		MaxConnections: 1,
+	}, "file:"+config.Path+"?"+parameters.Encode())
+}
@@ -0,0 +1,53 @@
+package sqlitedatabase
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"thesis/scraper/internal"
+	"time"
+)
+
+// A corrected grouping key leaves no metrics of the repository in its previous
+// group.
+func TestGroupingKeyCorrection(t *testing.T) {
+	ctx := context.Background()
+	store := Open(internal.SqliteConfig{Path: filepath.Join(t.TempDir(), "scraper.db")})
+	defer store.Close()
+
+	github := internal.Adapter{Name: "github"}
+	one := internal.Repository{Id: "1", FullName: "org/one", GroupingKey: "org"}
+	two := internal.Repository{Id: "2", FullName: "org/two", GroupingKey: "org"}
+	durations := map[string]internal.IssueDuration{"10": {Duration: time.Hour, CreatedAt: time.Now()}}
+
+	for _, repo := range []internal.Repository{one, two} {
+		store.InsertRepository(ctx, github, repo)
+		store.InsertDeploymentFrequency(ctx, github, repo, map[string]int{"2024-03-01": 2})
+		store.InsertLeadTimeForChange(ctx, github, repo, map[string]internal.IssueDuration{repo.Id + "0": durations["10"]})
+		store.InsertTimesToRestoreService(ctx, github, repo, map[string]internal.IssueDuration{repo.Id + "0": durations["10"]})
+		store.InsertChangeFailureRate(ctx, github, repo, 0.5)
+	}
+
+	correct := func(repo internal.Repository, groupingKey string) {
+		if err := store.ApplyCorrection(ctx, internal.Correction{Adapter: github.Name, RepositoryId: repo.Id, Entity: "repositories", Id: repo.Id, Fields: map[string]string{"grouping_key": groupingKey}, Author: "test", CorrectedAt: time.Now()}, map[string]any{"grouping_key": groupingKey}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	correct(one, "team")
+	frequencies, _ := store.ListDeploymentFrequency(ctx, github, one)
+	leadTimes, _ := store.ListLeadTimeForChange(ctx, github, one)
+	timesToRestoreService, _ := store.ListTimesToRestoreService(ctx, github, one)
+	rate, _ := store.ListChangeFailureRate(ctx, github, one)
+	if len(frequencies) != 0 || len(leadTimes) != 1 || len(timesToRestoreService) != 1 || rate != 0.5 {
+		t.Errorf("the old group kept %v, %v, %v and %v, want only the metrics of the other repository", frequencies, leadTimes, timesToRestoreService, rate)
+	}
+	if _, ok := leadTimes["20"]; !ok {
+		t.Errorf("the lead times of the other repository were deleted: %v", leadTimes)
+	}
+
+	correct(two, "team")
+	if rate, _ := store.ListChangeFailureRate(ctx, github, two); rate != 0 {
+		t.Errorf("the change failure rate of the empty group is %v, want it deleted", rate)
+	}
+}
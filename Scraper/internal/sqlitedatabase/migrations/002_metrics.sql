@@ -0,0 +1,44 @@
+create table if not exists deployment_frequencies
+(
+    adapter         TEXT NOT NULL,
+    grouping_key    TEXT NOT NULL,
+    repository_id   TEXT NOT NULL,
+    repository_name TEXT,
+    date            TIMESTAMP NOT NULL,
+    frequency       INTEGER,
+    primary key (adapter, grouping_key, repository_id, date)
+);
+
+
+create table if not exists lead_times
+(
+    adapter                TEXT NOT NULL,
+    repository_id          TEXT NOT NULL,
+    repository_name        TEXT,
+    issue_id               TEXT NOT NULL,
+    lead_time_nanoseconds  BIGINT,
+    lead_time_milliseconds BIGINT,
+    primary key (adapter, repository_id, issue_id)
+);
+
+
+create table if not exists change_failure_rates
+(
+    adapter         TEXT NOT NULL,
+    repository_id   TEXT NOT NULL,
+    repository_name TEXT,
+    rate            REAL,
+    primary key (adapter, repository_id)
+);
+
+
+create table if not exists times_to_restore_service
+(
+    adapter                              TEXT NOT NULL,
+    repository_id                        TEXT NOT NULL,
+    repository_name                      TEXT,
+    issue_id                             TEXT NOT NULL,
+    time_to_restore_service_nanoseconds  BIGINT,
+    time_to_restore_service_milliseconds BIGINT,
+    primary key (adapter, repository_id, issue_id)
+);
@@ -0,0 +1,5 @@
+-- Items that vanished upstream are tombstoned instead of being kept forever
+alter table issues add column deleted_at TIMESTAMP;
+alter table pull_requests add column deleted_at TIMESTAMP;
+alter table deployments add column deleted_at TIMESTAMP;
+alter table environments add column deleted_at TIMESTAMP;
@@ -0,0 +1,82 @@
+package sqlitedatabase
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"thesis/scraper/internal"
+	"time"
+)
+
+// A write that fails returns its rows instead of stopping the scraper.
+func TestWritesReturnFailedRows(t *testing.T) {
+	ctx := context.Background()
+	store := Open(internal.SqliteConfig{Path: filepath.Join(t.TempDir(), "scraper.db")})
+	store.Close()
+
+	github := internal.Adapter{Name: "github"}
+	repo := internal.Repository{Id: "1", FullName: "org/one", GroupingKey: "org"}
+	commits := []internal.Commit{{Sha: "a", CreatedAt: time.Now()}, {Sha: "b", CreatedAt: time.Now()}}
+
+	if failures := store.InsertCommits(ctx, github, repo, commits); len(failures) != len(commits) {
+		t.Errorf("%d of %d commits failed on a closed database", len(failures), len(commits))
+	}
+	if failures := store.InsertDeploymentFrequency(ctx, github, repo, map[string]int{"2024-03-01": 1}); len(failures) == 0 {
+		t.Error("the deployment frequencies didn't fail on a closed database")
+	}
+	if _, err := store.ListCommits(ctx, github, repo); err == nil {
+		t.Error("reading a closed database didn't fail")
+	}
+	correction := internal.Correction{Adapter: github.Name, RepositoryId: repo.Id, Entity: "repositories", Id: repo.Id, Fields: map[string]string{"grouping_key": "other"}, Author: "test", CorrectedAt: time.Now()}
+	if err := store.ApplyCorrection(ctx, correction, map[string]any{"grouping_key": "other"}); err == nil {
+		t.Error("correcting a closed database didn't fail")
+	}
+}
+
+func TestMarkDeletedUnknownEntity(t *testing.T) {
+	store := Open(internal.SqliteConfig{Path: filepath.Join(t.TempDir(), "scraper.db")})
+	defer store.Close()
+
+	failures := store.MarkDeleted(context.Background(), internal.Adapter{Name: "github"}, internal.Repository{Id: "1"}, "commits", []string{"a", "b"}, time.Now())
+	if len(failures) != 2 {
+		t.Errorf("%d of 2 commits failed to be marked as deleted, commits can't be deleted", len(failures))
+	}
+}
+
+func TestGetItem(t *testing.T) {
+	ctx := context.Background()
+	store := Open(internal.SqliteConfig{Path: filepath.Join(t.TempDir(), "scraper.db")})
+	defer store.Close()
+
+	github := internal.Adapter{Name: "github"}
+	repo := internal.Repository{Id: "1", FullName: "org/one", GroupingKey: "org"}
+	store.InsertRepository(ctx, github, repo)
+	store.InsertIssues(ctx, github, repo, []internal.Issue{{WorkItem: internal.WorkItem{ID: "10", CreatedAt: time.Now()}}, {WorkItem: internal.WorkItem{ID: "11", CreatedAt: time.Now()}}})
+	store.MarkDeleted(ctx, github, repo, "issues", []string{"11"}, time.Now())
+
+	tests := []struct {
+		entity string
+		id     string
+		found  bool
+	}{
+		{"repositories", "1", true},
+		{"repositories", "2", false},
+		{"issues", "10", true},
+		{"issues", "11", false},
+		{"issues", "12", false},
+	}
+
+	for _, test := range tests {
+		item, err := store.GetItem(ctx, github, repo.Id, test.entity, test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (item != nil) != test.found {
+			t.Errorf("GetItem(%s, %s) = %v, want found %v", test.entity, test.id, item, test.found)
+		}
+	}
+
+	if _, err := store.GetItem(ctx, github, repo.Id, "commits", "a"); err == nil {
+		t.Error("commits can't be read one by one, but GetItem didn't fail")
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Lease is a named lock held by one scraper instance. It expires after its
+// duration, so a lease of a crashed holder is released on its own.
+type Lease struct {
+	Name     string
+	Owner    string
+	Duration time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	lost     chan struct{}
+}
+
+var DefaultLeaseDuration = time.Minute
+
+// ErrLeaseLost is the cause of the cancellation of a context of WithLease.
+var ErrLeaseLost = errors.New("lease lost")
+
+// AcquireLease tries to take the lease with the given name for owner. It
+// returns nil if another instance currently holds it. The lease is renewed in
+// the background until it is released with ReleaseLease.
+func AcquireLease(store CoordinationStore, name string, owner string, duration time.Duration) *Lease {
+	if duration <= 0 {
+		duration = DefaultLeaseDuration
+	}
+
+	if !store.TryAcquireLease(name, owner, duration) {
+		return nil
+	}
+
+	lease := &Lease{
+		Name:     name,
+		Owner:    owner,
+		Duration: duration,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	go keepLease(store, lease)
+
+	return lease
+}
+
+// ReleaseLease stops renewing the lease and deletes it, as long as it is still
+// held by the same owner.
+func ReleaseLease(store CoordinationStore, lease *Lease) {
+	if lease == nil {
+		return
+	}
+
+	close(lease.stop)
+	<-lease.done
+
+	store.DeleteLease(lease.Name, lease.Owner)
+}
+
+// WithLease returns a context that is cancelled when the lease can't be
+// renewed, so another instance may already have taken over its work.
+func WithLease(ctx context.Context, lease *Lease) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		select {
+		case <-lease.lost:
+			cancel(ErrLeaseLost)
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+func keepLease(store CoordinationStore, lease *Lease) {
+	defer close(lease.done)
+
+	ticker := time.NewTicker(lease.Duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lease.stop:
+			return
+		case <-ticker.C:
+			if !store.RenewLease(lease.Name, lease.Owner, lease.Duration) {
+				slog.Warn("Lost lease", "lease", lease.Name)
+				close(lease.lost)
+				return
+			}
+		}
+	}
+}
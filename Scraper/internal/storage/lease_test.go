@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// leases is a CoordinationStore that grants every lease and renews it while
+// renew is set.
+type leases struct {
+	CoordinationStore
+	renew bool
+}
+
+func (l *leases) TryAcquireLease(name string, owner string, duration time.Duration) bool {
+	return true
+}
+
+func (l *leases) RenewLease(name string, owner string, duration time.Duration) bool {
+	return l.renew
+}
+
+func (l *leases) DeleteLease(name string, owner string) {}
+
+func TestWithLease(t *testing.T) {
+	tests := []struct {
+		name  string
+		renew bool
+		cause error
+	}{
+		{"renewed", true, context.Canceled},
+		{"lost", false, ErrLeaseLost},
+	}
+
+	for _, test := range tests {
+		store := &leases{renew: test.renew}
+		lease := AcquireLease(store, "repositories/github/1", "a", 30*time.Millisecond)
+		ctx, cancel := WithLease(context.Background(), lease)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(100 * time.Millisecond):
+			cancel()
+		}
+		ReleaseLease(store, lease)
+
+		if cause := context.Cause(ctx); !errors.Is(cause, test.cause) {
+			t.Errorf("%s: the work was cancelled with %v, want %v", test.name, cause, test.cause)
+		}
+	}
+}
@@ -0,0 +1,743 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"thesis/scraper/internal"
+	"thesis/scraper/internal/history"
+	"thesis/scraper/internal/storage"
+	"time"
+)
+
+var _ storage.Store = (*Store)(nil)
+
+// Store keeps all data in memory. It is meant for tests and dry runs, where
+// nothing may be written to a real database.
+type Store struct {
+	mutex sync.RWMutex
+
+	repositories map[key]row[internal.Repository]
+	issues       map[key]row[internal.Issue]
+	commits      map[key]row[internal.Commit]
+	pullRequests map[key]row[internal.PullRequest]
+	deployments  map[key]row[internal.Deployment]
+	environments map[key]row[internal.Environment]
+
+	deploymentFrequencies map[key]map[string]int
+	leadTimes             map[key]map[string]internal.IssueDuration
+	changeFailureRates    map[key]float64
+	timesToRestoreService map[key]map[string]internal.IssueDuration
+
+	corrections []internal.Correction
+	changes     []internal.Change
+
+	runs      map[string]internal.ScrapeRun
+	leases    map[string]lease
+	instances map[string]time.Time
+}
+
+type key struct {
+	adapter      string
+	repositoryId string
+	id           string
+}
+
+type row[T any] struct {
+	value             T
+	manuallyCorrected bool
+	deletedAt         *time.Time
+}
+
+type lease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		repositories:          make(map[key]row[internal.Repository]),
+		issues:                make(map[key]row[internal.Issue]),
+		commits:               make(map[key]row[internal.Commit]),
+		pullRequests:          make(map[key]row[internal.PullRequest]),
+		deployments:           make(map[key]row[internal.Deployment]),
+		environments:          make(map[key]row[internal.Environment]),
+		deploymentFrequencies: make(map[key]map[string]int),
+		leadTimes:             make(map[key]map[string]internal.IssueDuration),
+		changeFailureRates:    make(map[key]float64),
+		timesToRestoreService: make(map[key]map[string]internal.IssueDuration),
+		runs:                  make(map[string]internal.ScrapeRun),
+		leases:                make(map[string]lease),
+		instances:             make(map[string]time.Time),
+	}
+}
+
+func repositoryKey(adapter internal.Adapter, repository internal.Repository) key {
+	return key{adapter: adapter.Name, repositoryId: repository.Id}
+}
+
+// upsert stores value unless the existing row was manually corrected. It
+// returns the value it overwrote, unless the row was new or deleted.
+func upsert[T any](rows map[key]row[T], k key, value T) (overwritten *T) {
+	existing, ok := rows[k]
+	if ok && existing.manuallyCorrected {
+		return nil
+	}
+
+	rows[k] = row[T]{value: value}
+	if ok && existing.deletedAt == nil {
+		return &existing.value
+	}
+
+	return nil
+}
+
+// upsertAll upserts the items of a repository and returns the changes of the
+// rows it overwrote.
+func upsertAll[T any](rows map[key]row[T], adapter internal.Adapter, repository internal.Repository, entity string, items []T) []internal.Change {
+	var stored []T
+	for _, item := range items {
+		if overwritten := upsert(rows, key{adapter.Name, repository.Id, history.Id(item)}, item); overwritten != nil {
+			stored = append(stored, *overwritten)
+		}
+	}
+
+	return history.Overwritten(adapter.Name, repository.Id, entity, stored, items)
+}
+
+// markDeleted tombstones the row unless it was manually corrected.
+func markDeleted[T any](rows map[key]row[T], k key, deletedAt time.Time) {
+	existing, ok := rows[k]
+	if !ok || existing.manuallyCorrected {
+		return
+	}
+
+	existing.deletedAt = &deletedAt
+	rows[k] = existing
+}
+
+func list[T any](rows map[key]row[T], adapter internal.Adapter, repository internal.Repository) (values []T) {
+	var keys []key
+	for k := range rows {
+		if k.adapter == adapter.Name && k.repositoryId == repository.Id {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].id < keys[j].id
+	})
+
+	for _, k := range keys {
+		if rows[k].deletedAt == nil {
+			values = append(values, rows[k].value)
+		}
+	}
+
+	return
+}
+
+func (s *Store) InsertRepository(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Change, []storage.RowError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var stored []internal.Repository
+	if overwritten := upsert(s.repositories, key{adapter: adapter.Name, id: repository.Id}, repository); overwritten != nil {
+		stored = append(stored, *overwritten)
+	}
+
+	return history.Overwritten(adapter.Name, repository.Id, storage.EntityRepositories, stored, []internal.Repository{repository}), nil
+}
+
+func (s *Store) InsertIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository, issues []internal.Issue) ([]internal.Change, []storage.RowError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var items []internal.Issue
+	for _, issue := range issues {
+		issue.Repo = &repository
+		items = append(items, issue)
+	}
+
+	return upsertAll(s.issues, adapter, repository, storage.EntityIssues, items), nil
+}
+
+func (s *Store) InsertCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository, commits []internal.Commit) []storage.RowError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, commit := range commits {
+		commit.Repo = &repository
+		upsert(s.commits, key{adapter.Name, repository.Id, commit.Sha}, commit)
+	}
+
+	return nil
+}
+
+func (s *Store) InsertPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository, pullRequests []internal.PullRequest) ([]internal.Change, []storage.RowError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var items []internal.PullRequest
+	for _, pullRequest := range pullRequests {
+		pullRequest.Repo = &repository
+		items = append(items, pullRequest)
+	}
+
+	return upsertAll(s.pullRequests, adapter, repository, storage.EntityPullRequests, items), nil
+}
+
+func (s *Store) InsertDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, deployments []internal.Deployment) ([]internal.Change, []storage.RowError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return upsertAll(s.deployments, adapter, repository, storage.EntityDeployments, deployments), nil
+}
+
+func (s *Store) InsertEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, environments []internal.Environment) ([]internal.Change, []storage.RowError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return upsertAll(s.environments, adapter, repository, storage.EntityEnvironments, environments), nil
+}
+
+func (s *Store) ListRepositories(ctx context.Context, adapter internal.Adapter) ([]internal.Repository, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return list(s.repositories, adapter, internal.Repository{}), nil
+}
+
+func (s *Store) ListIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Issue, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return list(s.issues, adapter, repository), nil
+}
+
+func (s *Store) ListCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Commit, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return list(s.commits, adapter, repository), nil
+}
+
+func (s *Store) ListPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.PullRequest, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return list(s.pullRequests, adapter, repository), nil
+}
+
+func (s *Store) ListDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Deployment, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return list(s.deployments, adapter, repository), nil
+}
+
+func (s *Store) ListEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Environment, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return list(s.environments, adapter, repository), nil
+}
+
+// ids returns the ids of the rows of a repository that aren't deleted.
+func ids[T any](rows map[key]row[T], adapter internal.Adapter, repository internal.Repository) (ids []string) {
+	for k, r := range rows {
+		if k.adapter == adapter.Name && k.repositoryId == repository.Id && r.deletedAt == nil {
+			ids = append(ids, k.id)
+		}
+	}
+	sort.Strings(ids)
+
+	return
+}
+
+func (s *Store) ListIds(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	switch entity {
+	case storage.EntityIssues:
+		return ids(s.issues, adapter, repository), nil
+	case storage.EntityPullRequests:
+		return ids(s.pullRequests, adapter, repository), nil
+	case storage.EntityDeployments:
+		return ids(s.deployments, adapter, repository), nil
+	case storage.EntityEnvironments:
+		return ids(s.environments, adapter, repository), nil
+	}
+
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+func (s *Store) GetItem(ctx context.Context, adapter internal.Adapter, repositoryId string, entity string, id string) (any, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	k := key{adapter.Name, repositoryId, id}
+
+	switch entity {
+	case storage.EntityRepositories:
+		return get(s.repositories, key{adapter: adapter.Name, id: id}), nil
+	case storage.EntityIssues:
+		return get(s.issues, k), nil
+	case storage.EntityPullRequests:
+		return get(s.pullRequests, k), nil
+	case storage.EntityDeployments:
+		return get(s.deployments, k), nil
+	case storage.EntityEnvironments:
+		return get(s.environments, k), nil
+	}
+
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+// get returns the value of a row that isn't deleted, or nil.
+func get[T any](rows map[key]row[T], k key) any {
+	r, ok := rows[k]
+	if !ok || r.deletedAt != nil {
+		return nil
+	}
+
+	return r.value
+}
+
+func (s *Store) MarkDeleted(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string, ids []string, deletedAt time.Time) []storage.RowError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, id := range ids {
+		k := key{adapter.Name, repository.Id, id}
+
+		switch entity {
+		case storage.EntityIssues:
+			markDeleted(s.issues, k, deletedAt)
+		case storage.EntityPullRequests:
+			markDeleted(s.pullRequests, k, deletedAt)
+		case storage.EntityDeployments:
+			markDeleted(s.deployments, k, deletedAt)
+		case storage.EntityEnvironments:
+			markDeleted(s.environments, k, deletedAt)
+		}
+	}
+
+	return nil
+}
+
+// correct applies change to the row and marks it as manually corrected.
+func correct[T any](rows map[key]row[T], k key, change func(*T)) {
+	existing, ok := rows[k]
+	if !ok {
+		return
+	}
+
+	change(&existing.value)
+	existing.manuallyCorrected = true
+	rows[k] = existing
+}
+
+func (s *Store) ApplyCorrection(ctx context.Context, correction internal.Correction, values map[string]any) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k := key{correction.Adapter, correction.RepositoryId, correction.Id}
+
+	switch correction.Entity {
+	case storage.EntityRepositories:
+		correct(s.repositories, key{adapter: correction.Adapter, id: correction.Id}, func(r *internal.Repository) {
+			for field, value := range values {
+				switch field {
+				case "full_name":
+					r.FullName = value.(string)
+				case "default_branch":
+					r.DefaultBranch = value.(string)
+				case "grouping_key":
+					r.GroupingKey = value.(string)
+				}
+			}
+		})
+	case storage.EntityIssues:
+		correct(s.issues, k, func(i *internal.Issue) {
+			for field, value := range values {
+				switch field {
+				case "type":
+					i.Type = stringPointer(value)
+				case "created_at":
+					i.CreatedAt = value.(time.Time)
+				case "closed_at":
+					i.ClosedAt = timePointer(value)
+				}
+			}
+		})
+	case storage.EntityPullRequests:
+		correct(s.pullRequests, k, func(p *internal.PullRequest) {
+			for field, value := range values {
+				switch field {
+				case "created_at":
+					p.CreatedAt = value.(time.Time)
+				case "closed_at":
+					p.ClosedAt = timePointer(value)
+				case "merged_at":
+					p.MergedAt = timePointer(value)
+				}
+			}
+		})
+	case storage.EntityDeployments:
+		correct(s.deployments, k, func(d *internal.Deployment) {
+			for field, value := range values {
+				switch field {
+				case "sha":
+					d.Sha = value.(string)
+				case "ref":
+					d.Ref = value.(string)
+				case "task":
+					d.Task = value.(string)
+				case "commit_id":
+					d.Commit = nil
+					if id := stringPointer(value); id != nil {
+						d.Commit = &internal.Commit{Sha: *id}
+					}
+				case "environment_id":
+					d.Environment = nil
+					if id := stringPointer(value); id != nil {
+						d.Environment = &internal.Environment{Id: *id}
+					}
+				case "created_at":
+					d.CreatedAt = value.(time.Time)
+				case "updated_at":
+					d.UpdatedAt = value.(time.Time)
+				}
+			}
+		})
+	}
+
+	s.corrections = append(s.corrections, correction)
+
+	return nil
+}
+
+func (s *Store) ListCorrections(ctx context.Context, adapter string, repositoryId string) (corrections []internal.Correction, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for i := len(s.corrections) - 1; i >= 0; i-- {
+		c := s.corrections[i]
+		if c.Adapter == adapter && c.RepositoryId == repositoryId {
+			corrections = append(corrections, c)
+		}
+	}
+
+	return
+}
+
+func (s *Store) InsertChanges(ctx context.Context, changes []internal.Change) []storage.RowError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.changes = append(s.changes, changes...)
+
+	return nil
+}
+
+func (s *Store) ListChanges(ctx context.Context, adapter string, repositoryId string, entity string, id string) (changes []internal.Change, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for i := len(s.changes) - 1; i >= 0; i-- {
+		c := s.changes[i]
+		if c.Adapter == adapter && c.RepositoryId == repositoryId && c.Entity == entity && c.Id == id {
+			changes = append(changes, c)
+		}
+	}
+
+	return
+}
+
+// prune deletes the rows whose age, according to createdAt, is before before.
+func prune[T any](rows map[key]row[T], before time.Time, createdAt func(T) time.Time) (deleted int) {
+	for k, r := range rows {
+		if createdAt(r.value).Before(before) {
+			delete(rows, k)
+			deleted++
+		}
+	}
+
+	return
+}
+
+// Prune deletes old rows. The metrics per issue age with their issue.
+func (s *Store) Prune(ctx context.Context, table string, before time.Time) (deleted int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch table {
+	case storage.TableIssues:
+		return prune(s.issues, before, func(i internal.Issue) time.Time { return i.CreatedAt }), nil
+	case storage.TableCommits:
+		return prune(s.commits, before, func(c internal.Commit) time.Time { return c.CreatedAt }), nil
+	case storage.TablePullRequests:
+		return prune(s.pullRequests, before, func(p internal.PullRequest) time.Time { return p.CreatedAt }), nil
+	case storage.TableDeployments:
+		return prune(s.deployments, before, func(d internal.Deployment) time.Time { return d.CreatedAt }), nil
+	case storage.TableEnvironments:
+		return prune(s.environments, before, func(e internal.Environment) time.Time { return e.CreatedAt }), nil
+	case storage.TableDeploymentFrequencies:
+		for _, frequencies := range s.deploymentFrequencies {
+			for date := range frequencies {
+				if day, err := time.Parse(time.DateOnly, date); err == nil && day.Before(before) {
+					delete(frequencies, date)
+					deleted++
+				}
+			}
+		}
+	case storage.TableLeadTimes:
+		return pruneDurations(s.leadTimes, before), nil
+	case storage.TableTimesToRestoreService:
+		return pruneDurations(s.timesToRestoreService, before), nil
+	case storage.TableScrapeRuns:
+		for id, run := range s.runs {
+			if run.StartedAt.Before(before) {
+				delete(s.runs, id)
+				deleted++
+			}
+		}
+	case storage.TableChanges:
+		var kept []internal.Change
+		for _, change := range s.changes {
+			if change.ChangedAt.Before(before) {
+				deleted++
+			} else {
+				kept = append(kept, change)
+			}
+		}
+		s.changes = kept
+	default:
+		return 0, fmt.Errorf("%q can't be pruned", table)
+	}
+
+	return
+}
+
+// pruneDurations deletes the metrics of issues that were created before before.
+func pruneDurations(durations map[key]map[string]internal.IssueDuration, before time.Time) (deleted int) {
+	for _, issues := range durations {
+		for issueId, duration := range issues {
+			if duration.CreatedAt.Before(before) {
+				delete(issues, issueId)
+				deleted++
+			}
+		}
+	}
+
+	return
+}
+
+func stringPointer(value any) *string {
+	if value == nil {
+		return nil
+	}
+	s := value.(string)
+	return &s
+}
+
+func timePointer(value any) *time.Time {
+	if value == nil {
+		return nil
+	}
+	t := value.(time.Time)
+	return &t
+}
+
+func (s *Store) InsertDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository, frequencies map[string]int) []storage.RowError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The metrics of deleted items are dropped, like in the databases
+	k := repositoryKey(adapter, repository)
+	s.deploymentFrequencies[k] = make(map[string]int)
+	for date, frequency := range frequencies {
+		s.deploymentFrequencies[k][date] = frequency
+	}
+
+	return nil
+}
+
+func (s *Store) InsertLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository, leadTimes map[string]internal.IssueDuration) []storage.RowError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k := repositoryKey(adapter, repository)
+	s.leadTimes[k] = make(map[string]internal.IssueDuration)
+	for issueId, leadTime := range leadTimes {
+		s.leadTimes[k][issueId] = leadTime
+	}
+
+	return nil
+}
+
+func (s *Store) InsertChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository, changeFailureRate float64) []storage.RowError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.changeFailureRates[repositoryKey(adapter, repository)] = changeFailureRate
+
+	return nil
+}
+
+func (s *Store) InsertTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository, timesToRestoreService map[string]internal.IssueDuration) []storage.RowError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k := repositoryKey(adapter, repository)
+	s.timesToRestoreService[k] = make(map[string]internal.IssueDuration)
+	for issueId, timeToRestoreService := range timesToRestoreService {
+		s.timesToRestoreService[k][issueId] = timeToRestoreService
+	}
+
+	return nil
+}
+
+func (s *Store) ListDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	frequencies := make(map[string]int)
+	for date, frequency := range s.deploymentFrequencies[repositoryKey(adapter, repository)] {
+		frequencies[date] = frequency
+	}
+
+	return frequencies, nil
+}
+
+func (s *Store) ListLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	leadTimes := make(map[string]time.Duration)
+	for issueId, leadTime := range s.leadTimes[repositoryKey(adapter, repository)] {
+		leadTimes[issueId] = leadTime.Duration
+	}
+
+	return leadTimes, nil
+}
+
+func (s *Store) ListChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (float64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.changeFailureRates[repositoryKey(adapter, repository)], nil
+}
+
+func (s *Store) ListTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	timesToRestoreService := make(map[string]time.Duration)
+	for issueId, timeToRestoreService := range s.timesToRestoreService[repositoryKey(adapter, repository)] {
+		timesToRestoreService[issueId] = timeToRestoreService.Duration
+	}
+
+	return timesToRestoreService, nil
+}
+
+func (s *Store) InsertScrapeRun(ctx context.Context, run internal.ScrapeRun) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.runs[strings.Join([]string{run.RunId, run.Stage, run.Adapter, run.RepositoryId}, "/")] = run
+}
+
+func (s *Store) ListScrapeRuns(ctx context.Context, adapter string, repositoryId string, limit int) (runs []internal.ScrapeRun, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, run := range s.runs {
+		if (adapter == "" || run.Adapter == adapter) && (repositoryId == "" || run.RepositoryId == repositoryId) {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return
+}
+
+func (s *Store) TryAcquireLease(name string, owner string, duration time.Duration) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, ok := s.leases[name]
+	if ok && existing.owner != owner && existing.expiresAt.After(time.Now()) {
+		return false
+	}
+
+	s.leases[name] = lease{owner: owner, expiresAt: time.Now().Add(duration)}
+	return true
+}
+
+func (s *Store) RenewLease(name string, owner string, duration time.Duration) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, ok := s.leases[name]
+	if !ok || existing.owner != owner || existing.expiresAt.Before(time.Now()) {
+		return false
+	}
+
+	s.leases[name] = lease{owner: owner, expiresAt: time.Now().Add(duration)}
+	return true
+}
+
+func (s *Store) DeleteLease(name string, owner string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if existing, ok := s.leases[name]; ok && existing.owner == owner {
+		delete(s.leases, name)
+	}
+}
+
+func (s *Store) RegisterInstance(id string, startedAt time.Time, ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.instances[id] = time.Now().Add(ttl)
+}
+
+func (s *Store) UnregisterInstance(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.instances, id)
+}
+
+func (s *Store) ListInstances() (ids []string, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	for id, expiresAt := range s.instances {
+		if expiresAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) Close() {
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The tables a retention can be configured for
+const (
+	TableIssues                = "issues"
+	TableCommits               = "commits"
+	TablePullRequests          = "pull_requests"
+	TableDeployments           = "deployments"
+	TableEnvironments          = "environments"
+	TableDeploymentFrequencies = "deployment_frequencies"
+	TableLeadTimes             = "lead_times"
+	TableTimesToRestoreService = "times_to_restore_service"
+	TableScrapeRuns            = "scrape_runs"
+	TableChanges               = "changes"
+)
+
+// RetentionColumns maps each table a retention can be configured for to the
+// column the age of its rows is measured by. The metrics per issue age with
+// their issue.
+var RetentionColumns = map[string]string{
+	TableIssues:                "created_at",
+	TableCommits:               "created_at",
+	TablePullRequests:          "created_at",
+	TableDeployments:           "created_at",
+	TableEnvironments:          "created_at",
+	TableDeploymentFrequencies: "date",
+	TableLeadTimes:             "issue_created_at",
+	TableTimesToRestoreService: "issue_created_at",
+	TableScrapeRuns:            "started_at",
+	TableChanges:               "changed_at",
+}
+
+// RetentionStore deletes the rows that are older than the retention of their
+// table.
+type RetentionStore interface {
+	// Prune deletes the rows of table that are older than before and returns
+	// how many it deleted.
+	Prune(ctx context.Context, table string, before time.Time) (int, error)
+}
+
+// ValidateRetention returns an error for tables that don't support a retention.
+func ValidateRetention(retention map[string]time.Duration) error {
+	for table, duration := range retention {
+		if _, ok := RetentionColumns[table]; !ok {
+			return fmt.Errorf("no retention can be configured for %q, use one of %s", table, strings.Join(RetentionTables(), ", "))
+		}
+		if duration < 0 {
+			return fmt.Errorf("the retention of %q is negative", table)
+		}
+	}
+
+	return nil
+}
+
+// RetentionTables returns the tables a retention can be configured for.
+func RetentionTables() (tables []string) {
+	for table := range RetentionColumns {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	return
+}
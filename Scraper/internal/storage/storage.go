@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"thesis/scraper/internal"
+	"time"
+)
+
+// RowError is a row that could not be written. The other rows of a write are
+// stored regardless, so the writes return their failed rows instead of
+// stopping.
+type RowError struct {
+	Statement string
+	Args      []any
+	Err       error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("%s %v: %v", e.Statement, e.Args, e.Err)
+}
+
+// Join returns the failed rows as one error, or nil if no row failed.
+func Join(failures []RowError) error {
+	var errs []error
+	for _, failure := range failures {
+		errs = append(errs, failure)
+	}
+
+	return errors.Join(errs...)
+}
+
+// BaseDataStore holds the data fetched from the adapters. Inserts never
+// overwrite rows that were manually corrected. They return the changes of the
+// tracked fields of the rows they overwrote, without a source and a time, so
+// the history doesn't need to read the repository before and after. Like all
+// writes, they also return the rows that could not be written.
+type BaseDataStore interface {
+	InsertRepository(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Change, []RowError)
+	InsertIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository, issues []internal.Issue) ([]internal.Change, []RowError)
+	InsertCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository, commits []internal.Commit) []RowError
+	InsertPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository, pullRequests []internal.PullRequest) ([]internal.Change, []RowError)
+	InsertDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, deployments []internal.Deployment) ([]internal.Change, []RowError)
+	InsertEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository, environments []internal.Environment) ([]internal.Change, []RowError)
+
+	ListRepositories(ctx context.Context, adapter internal.Adapter) ([]internal.Repository, error)
+	ListIssues(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Issue, error)
+	ListCommits(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Commit, error)
+	ListPullRequests(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.PullRequest, error)
+	ListDeployments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Deployment, error)
+	ListEnvironments(ctx context.Context, adapter internal.Adapter, repository internal.Repository) ([]internal.Environment, error)
+
+	// ListIds returns the ids of the stored items of entity that aren't deleted.
+	ListIds(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string) ([]string, error)
+	// GetItem returns one stored item of entity that isn't deleted, or nil if
+	// there is none. For repositories, repositoryId is ignored.
+	GetItem(ctx context.Context, adapter internal.Adapter, repositoryId string, entity string, id string) (any, error)
+
+	// MarkDeleted tombstones items that vanished upstream. Deleted items are left
+	// out of the List functions until an adapter returns them again.
+	MarkDeleted(ctx context.Context, adapter internal.Adapter, repository internal.Repository, entity string, ids []string, deletedAt time.Time) []RowError
+}
+
+// The entities that can be deleted upstream or corrected
+const (
+	EntityRepositories = "repositories"
+	EntityIssues       = "issues"
+	EntityPullRequests = "pull_requests"
+	EntityDeployments  = "deployments"
+	EntityEnvironments = "environments"
+)
+
+// MetricsStore holds the metrics calculated from the base data. The metrics of
+// a repository replace its earlier ones, so those of deleted items are removed.
+type MetricsStore interface {
+	InsertDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository, frequencies map[string]int) []RowError
+	InsertLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository, leadTimes map[string]internal.IssueDuration) []RowError
+	InsertChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository, changeFailureRate float64) []RowError
+	InsertTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository, timesToRestoreService map[string]internal.IssueDuration) []RowError
+
+	ListDeploymentFrequency(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]int, error)
+	ListLeadTimeForChange(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error)
+	ListChangeFailureRate(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (float64, error)
+	ListTimesToRestoreService(ctx context.Context, adapter internal.Adapter, repository internal.Repository) (map[string]time.Duration, error)
+}
+
+// RunStore keeps the history of scrape and aggregation runs.
+type RunStore interface {
+	InsertScrapeRun(ctx context.Context, run internal.ScrapeRun)
+	ListScrapeRuns(ctx context.Context, adapter string, repositoryId string, limit int) ([]internal.ScrapeRun, error)
+}
+
+// CoordinationStore lets several scraper instances share the work. Leases and
+// instance registrations expire after their duration unless they are renewed.
+type CoordinationStore interface {
+	TryAcquireLease(name string, owner string, duration time.Duration) bool
+	RenewLease(name string, owner string, duration time.Duration) bool
+	DeleteLease(name string, owner string)
+
+	RegisterInstance(id string, startedAt time.Time, ttl time.Duration)
+	UnregisterInstance(id string)
+	ListInstances() ([]string, error)
+}
+
+// CorrectionStore applies manual corrections. Corrected rows are marked as
+// manually corrected, so the next scrape doesn't overwrite them.
+type CorrectionStore interface {
+	// ApplyCorrection sets the fields to values, which were already parsed
+	// according to the type of each field. The correction is only recorded
+	// if the item was written.
+	ApplyCorrection(ctx context.Context, correction internal.Correction, values map[string]any) error
+	ListCorrections(ctx context.Context, adapter string, repositoryId string) ([]internal.Correction, error)
+}
+
+// HistoryStore keeps the changes of the fields of stored items.
+type HistoryStore interface {
+	InsertChanges(ctx context.Context, changes []internal.Change) []RowError
+	// ListChanges returns the changes of one item, newest first.
+	ListChanges(ctx context.Context, adapter string, repositoryId string, entity string, id string) ([]internal.Change, error)
+}
+
+// Store combines all parts of the storage. Reads return their errors to the
+// caller, which may be a request rather than a run.
+type Store interface {
+	BaseDataStore
+	MetricsStore
+	CorrectionStore
+	HistoryStore
+	RetentionStore
+	RunStore
+	CoordinationStore
+
+	// Ping reports whether the store can currently be reached.
+	Ping(ctx context.Context) error
+	Close()
+}
+
+// Migration is a version of the database schema. AppliedAt is nil while the
+// migration is pending, Known is false for migrations of a newer scraper.
+type Migration struct {
+	Version   string
+	AppliedAt *time.Time
+	Known     bool
+}
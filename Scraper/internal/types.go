@@ -13,11 +13,48 @@ type Adapter struct {
 	Token   string `yaml:"token"`
 }
 
+// DatabaseConfig configures Cassandra. Keyspace holds the base data and
+// defaults to base_data, MetricsKeyspace defaults to metrics. Tables renames
+// single tables, e.g. issues: issues_v2.
 type DatabaseConfig struct {
-	Hosts    []string `yaml:"hosts,omitempty"`
-	Username string   `yaml:"username,omitempty"`
-	Password string   `yaml:"password,omitempty"`
-	Keyspace string   `yaml:"keyspace,omitempty"`
+	Hosts           []string          `yaml:"hosts,omitempty"`
+	Username        string            `yaml:"username,omitempty"`
+	Password        string            `yaml:"password,omitempty"`
+	Keyspace        string            `yaml:"keyspace,omitempty"`
+	MetricsKeyspace string            `yaml:"metricskeyspace,omitempty"`
+	Tables          map[string]string `yaml:"tables,omitempty"`
+
+	ProtoVersion      int           `yaml:"protoversion,omitempty"`
+	ReadConsistency   string        `yaml:"readconsistency,omitempty"`
+	WriteConsistency  string        `yaml:"writeconsistency,omitempty"`
+	SerialConsistency string        `yaml:"serialconsistency,omitempty"`
+	LocalDatacenter   string        `yaml:"localdatacenter,omitempty"`
+	TokenAware        bool          `yaml:"tokenaware,omitempty"`
+	Timeout           time.Duration `yaml:"timeout,omitempty"`
+	ConnectTimeout    time.Duration `yaml:"connecttimeout,omitempty"`
+	Compression       string        `yaml:"compression,omitempty"`
+	MaxInFlight       int           `yaml:"maxinflight,omitempty"`
+	PageSize          int           `yaml:"pagesize,omitempty"`
+	Retry             RetryConfig   `yaml:"retry,omitempty"`
+	Tls               TlsConfig     `yaml:"tls,omitempty"`
+}
+
+// RetryConfig selects the retry policy of failed queries. Policy is simple,
+// exponential or downgrading, MinBackoff and MaxBackoff only apply to
+// exponential.
+type RetryConfig struct {
+	Policy     string        `yaml:"policy,omitempty"`
+	Retries    int           `yaml:"retries,omitempty"`
+	MinBackoff time.Duration `yaml:"minbackoff,omitempty"`
+	MaxBackoff time.Duration `yaml:"maxbackoff,omitempty"`
+}
+
+type TlsConfig struct {
+	Enabled    bool   `yaml:"enabled,omitempty"`
+	CaPath     string `yaml:"capath,omitempty"`
+	CertPath   string `yaml:"certpath,omitempty"`
+	KeyPath    string `yaml:"keypath,omitempty"`
+	VerifyHost bool   `yaml:"verifyhost,omitempty"`
 }
 
 type BaseDatabaseConfig struct {
@@ -27,11 +64,62 @@ type BaseDatabaseConfig struct {
 	Database string `yaml:"database,omitempty"`
 }
 
+type ScraperConfig struct {
+	Instance      string        `yaml:"instance,omitempty"`
+	LeaseDuration time.Duration `yaml:"leaseduration,omitempty"`
+	Interval      time.Duration `yaml:"interval,omitempty"`
+	Overrides     string        `yaml:"overrides,omitempty"`
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level,omitempty"`
+	Format string `yaml:"format,omitempty"`
+}
+
+type ServerConfig struct {
+	Listen string        `yaml:"listen,omitempty"`
+	Tokens []TokenConfig `yaml:"tokens,omitempty"`
+}
+
+// TokenConfig grants User access to the API with a bearer token.
+type TokenConfig struct {
+	User  string `yaml:"user"`
+	Token string `yaml:"token"`
+}
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"`
+}
+
+type StorageConfig struct {
+	Backend string `yaml:"backend,omitempty"`
+	// Retention maps tables to how long their rows are kept, see
+	// storage.RetentionColumns. Tables without one are kept forever.
+	Retention map[string]time.Duration `yaml:"retention,omitempty"`
+}
+
+type PostgresConfig struct {
+	Dsn string `yaml:"dsn,omitempty"`
+}
+
+type SqliteConfig struct {
+	Path string `yaml:"path,omitempty"`
+}
+
 type Config struct {
 	Adapters     []Adapter          `yaml:"adapters"`
 	Repositories []ConfigRepository `yaml:"repositories"`
+	Storage      StorageConfig      `yaml:"storage"`
 	Database     DatabaseConfig     `yaml:"metricsdatabase"`
+	Postgres     PostgresConfig     `yaml:"postgres"`
+	Sqlite       SqliteConfig       `yaml:"sqlite"`
 	BaseData     BaseDatabaseConfig `json:"baseData"`
+	Scraper      ScraperConfig      `yaml:"scraper"`
+	Logging      LoggingConfig      `yaml:"logging"`
+	Server       ServerConfig       `yaml:"server"`
+	Tracing      TracingConfig      `yaml:"tracing"`
 }
 
 // HTTP Response Types
@@ -77,6 +165,13 @@ type Issue struct {
 	Type         *string  `json:"type,omitempty"`
 }
 
+// IssueDuration is a metric of an issue that is measured as a duration, with
+// the creation time of the issue, which its retention is measured from.
+type IssueDuration struct {
+	Duration  time.Duration
+	CreatedAt time.Time
+}
+
 type Environment struct {
 	Id        string    `json:"id"`
 	Name      string    `json:"name"`
@@ -94,3 +189,54 @@ type Deployment struct {
 	CreatedAt   time.Time    `json:"created_At"`
 	UpdatedAt   time.Time    `json:"updated_At"`
 }
+
+// Scrape Runs
+const (
+	RunStageScrape    = "scrape"
+	RunStageAggregate = "aggregate"
+
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusPartial   = "partial"
+	RunStatusFailed    = "failed"
+)
+
+type ScrapeRun struct {
+	RunId          string         `json:"run_id"`
+	Adapter        string         `json:"adapter"`
+	RepositoryId   string         `json:"repository_id"`
+	Stage          string         `json:"stage"`
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     *time.Time     `json:"finished_at,omitempty"`
+	Status         string         `json:"status"`
+	Counts         map[string]int `json:"counts,omitempty"`
+	Errors         []string       `json:"errors,omitempty"`
+	Instance       string         `json:"instance"`
+	ScraperVersion string         `json:"scraper_version"`
+}
+
+// Correction is a manual change of a stored item. For repositories,
+// RepositoryId and Id are both the id of the repository.
+type Correction struct {
+	Adapter      string            `json:"adapter"`
+	RepositoryId string            `json:"repository_id"`
+	Entity       string            `json:"entity"`
+	Id           string            `json:"id"`
+	Fields       map[string]string `json:"fields"`
+	Author       string            `json:"author"`
+	CorrectedAt  time.Time         `json:"corrected_at"`
+}
+
+// Change is a field of a stored item that changed, either upstream or by a
+// correction.
+type Change struct {
+	Adapter      string    `json:"adapter"`
+	RepositoryId string    `json:"repository_id"`
+	Entity       string    `json:"entity"`
+	Id           string    `json:"id"`
+	Field        string    `json:"field"`
+	OldValue     string    `json:"old_value"`
+	NewValue     string    `json:"new_value"`
+	Source       string    `json:"source"`
+	ChangedAt    time.Time `json:"changed_at"`
+}
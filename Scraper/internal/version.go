@@ -0,0 +1,4 @@
+package internal
+
+// Version is set at build time with -ldflags "-X thesis/scraper/internal.Version=..."
+var Version = "dev"
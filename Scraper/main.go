@@ -1,38 +1,213 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v2"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"thesis/scraper/internal"
 	"thesis/scraper/internal/basedatabase"
+	"thesis/scraper/internal/corrections"
+	"thesis/scraper/internal/health"
 	"thesis/scraper/internal/metricsdatabase"
+	"thesis/scraper/internal/monitoring"
+	"thesis/scraper/internal/postgresdatabase"
 	"thesis/scraper/internal/processing"
+	"thesis/scraper/internal/sharding"
+	"thesis/scraper/internal/sqlitedatabase"
+	"thesis/scraper/internal/storage"
+	"thesis/scraper/internal/storage/memory"
+	"thesis/scraper/internal/tracing"
+	"time"
 )
 
 var config internal.Config
 var metricsDatabase *metricsdatabase.DatabaseClient
+var store storage.Store
 var baseDatabase *basedatabase.DatabaseClient
+var membership *sharding.Membership
+
+var dryRun = flag.Bool("dry-run", false, "fetch and aggregate without writing to Cassandra, and print the writes instead (only supported by the cassandra backend)")
+var dryRunOutput = flag.String("dry-run-output", "", "write the writes of a dry run as JSON to this file")
 
 func main() {
 	readConfig()
-	connectToDatabase()
-	defer metricsdatabase.Close(metricsDatabase)
+	internal.ConfigureLogging(config.Logging)
+
+	flag.Parse()
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+		return
+	}
+
+	openStore()
+	defer store.Close()
 	connectToBaseDatabase()
 	defer basedatabase.Close(baseDatabase)
 
+	if *dryRun {
+		runDry()
+		return
+	}
+
+	membership = sharding.Join(store, config.Scraper.Instance, config.Scraper.LeaseDuration)
+	defer sharding.Leave(membership)
+
+	shutdownTracing := tracing.Configure(config.Tracing)
+	defer shutdownTracing(context.Background())
+
+	startServer()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if config.Scraper.Interval <= 0 {
+		run(ctx)
+		return
+	}
+
+	ticker := time.NewTicker(config.Scraper.Interval)
+	defer ticker.Stop()
+
+	for {
+		run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func run(ctx context.Context) {
+	runId := internal.NewRunId()
+	logger := slog.With("run_id", runId, "instance", config.Scraper.Instance)
+	logger.Info("Starting run")
+	start := time.Now()
+
+	ctx, span := tracing.Start(ctx, "run")
+	defer span.End()
+	span.SetAttributes(attribute.String("run_id", runId))
+
+	sharding.Refresh(membership)
+
 	group := sync.WaitGroup{}
 
 	for _, repository := range config.Repositories {
-		log.Printf("Processing Repo %s\n", repository.Id)
-		processing.HandleRepository(repository, findAdapter(repository, config.Adapters), baseDatabase, metricsDatabase, &group)
+		if !sharding.Owns(membership, repository.Adapter, repository.Id) {
+			continue
+		}
+
+		processing.HandleRepository(ctx, runId, repository, findAdapter(repository, config.Adapters), config.Scraper, logger, baseDatabase, store, &group)
 	}
 	group.Wait()
 
+	applyOverrides(ctx, logger)
+
 	for _, adapter := range config.Adapters {
-		processing.Aggregate(adapter, metricsDatabase)
+		processing.Aggregate(ctx, runId, adapter, config.Scraper, membership, logger, store)
+	}
+
+	logger.Info("Finished run", "duration", time.Since(start))
+}
+
+// applyOverrides applies the overrides file after the scrape, so the
+// aggregation already uses the overridden values.
+func applyOverrides(ctx context.Context, logger *slog.Logger) {
+	if config.Scraper.Overrides == "" {
+		return
+	}
+
+	overrides, err := corrections.ReadOverrides(config.Scraper.Overrides)
+	if err != nil {
+		logger.Error("Could not apply the overrides", internal.ErrorAttr(err))
+		return
+	}
+
+	owns := func(adapter string, repositoryId string) bool {
+		return sharding.Owns(membership, adapter, repositoryId)
+	}
+	for _, override := range corrections.ApplyOverrides(ctx, overrides, config.Adapters, owns, store) {
+		logger.Warn("Override wasn't applied", "adapter", override.Adapter, "repository", override.Repository, "entity", override.Entity, "id", override.Id, internal.ErrorAttr(override.Err))
+	}
+}
+
+// runDry runs once for all repositories, since a dry run doesn't take part in
+// sharding, and reports the writes it recorded.
+func runDry() {
+	if metricsDatabase == nil {
+		internal.ProcessError(fmt.Errorf("dry runs are only supported by the cassandra backend"))
+	}
+
+	recorder := metricsdatabase.NewRecorder()
+	metricsdatabase.EnableDryRun(metricsDatabase, recorder)
+
+	// Nothing is archived during a dry run
+	baseDatabase = nil
+
+	run(context.Background())
+
+	if *dryRunOutput == "" {
+		metricsdatabase.PrintDryRun(recorder, os.Stdout)
+		return
+	}
+
+	f, err := os.Create(*dryRunOutput)
+	if err != nil {
+		internal.ProcessError(err)
+	}
+	defer f.Close()
+
+	metricsdatabase.WriteDryRun(recorder, f)
+}
+
+func startServer() {
+	if config.Server.Listen == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", monitoring.Handler())
+	mux.Handle("/healthz", health.LivenessHandler())
+	mux.Handle("/readyz", health.ReadinessHandler(config.Adapters, store, baseDatabase))
+	if len(config.Server.Tokens) > 0 {
+		mux.Handle(corrections.Prefix, corrections.Handler(config.Adapters, config.Server.Tokens, store, reaggregate))
+	}
+
+	go func() {
+		slog.Info("Listening", "address", config.Server.Listen)
+		err := http.ListenAndServe(config.Server.Listen, mux)
+		if err != nil {
+			internal.ProcessError(err)
+		}
+	}()
+}
+
+// reaggregate recalculates the metrics of a repository after a correction.
+func reaggregate(adapter internal.Adapter, repositoryId string) {
+	ctx := context.Background()
+	runId := internal.NewRunId()
+	logger := slog.With("run_id", runId, "instance", config.Scraper.Instance)
+
+	repos, err := store.ListRepositories(ctx, adapter)
+	if err != nil {
+		logger.Error("Could not list the repositories to reaggregate", "adapter", adapter.Name, internal.ErrorAttr(err))
+		return
+	}
+
+	for _, repo := range repos {
+		if repo.Id == repositoryId {
+			processing.AggregateRepository(ctx, runId, adapter, repo, config.Scraper, logger, store)
+		}
 	}
 }
 
@@ -47,17 +222,56 @@ func findAdapter(repository internal.ConfigRepository, adapters []internal.Adapt
 	return
 }
 
+func openStore() {
+	if err := storage.ValidateRetention(config.Storage.Retention); err != nil {
+		internal.ProcessError(err)
+	}
+
+	switch strings.ToLower(config.Storage.Backend) {
+	case "", "cassandra":
+		connectToDatabase()
+		metricsdatabase.EnableRetention(metricsDatabase, config.Storage.Retention)
+		// The SQL backends migrate on their own, Cassandra schema changes are applied explicitly
+		if err := metricsdatabase.CheckSchema(metricsDatabase); err != nil {
+			internal.ProcessError(err)
+		}
+		store = metricsdatabase.NewStore(metricsDatabase)
+	case "memory":
+		store = memory.NewStore()
+	case "postgres":
+		store = postgresdatabase.Open(config.Postgres)
+	case "sqlite":
+		store = sqlitedatabase.Open(config.Sqlite)
+	default:
+		internal.ProcessError(fmt.Errorf("unknown storage backend %q", config.Storage.Backend))
+	}
+}
+
 func connectToDatabase() {
 	metricsDatabase = metricsdatabase.CreateClient(config.Database)
 	metricsdatabase.Connect(metricsDatabase)
 }
 
+// connectToBaseDatabase connects to the archive of the raw payloads, if one is
+// configured. Without it the payloads aren't archived.
 func connectToBaseDatabase() {
+	if config.BaseData.Host == "" {
+		return
+	}
+
 	baseDatabase = basedatabase.CreateClient(config.BaseData)
 }
 
 func readConfig() {
 	readFile(&config)
+
+	if config.Scraper.Instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			internal.ProcessError(err)
+		}
+		config.Scraper.Instance = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
 }
 
 func readFile(cfg *internal.Config) {